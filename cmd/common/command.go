@@ -0,0 +1,112 @@
+package common
+
+import (
+	"os"
+
+	"github.com/jbester/pwdb/pkg/pwdb"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// Something commands can be added to; an application or a parent command
+type Commander interface {
+	Command(name string, help string) *kingpin.CmdClause
+}
+
+// State shared by the command being run
+type Context struct {
+	ConfigPath string
+	vault      *pwdb.Vault
+}
+
+// The vault, locking and opening it on first use so commands that don't need
+// it never prompt for the passphrase
+func (ctx *Context) Vault() (*pwdb.Vault, error) {
+	if ctx.vault == nil {
+		vault, err := OpenVault(ctx.ConfigPath)
+		if err != nil {
+			return nil, err
+		}
+		ctx.vault = vault
+	}
+	return ctx.vault, nil
+}
+
+// Close the vault if it was opened
+func (ctx *Context) Close() error {
+	if ctx.vault == nil {
+		return nil
+	}
+	return ctx.vault.Close()
+}
+
+// Runs a command
+type Handler func(ctx *Context) error
+
+// The handlers of an application's commands by full command name
+type Registry struct {
+	handlers map[string]Handler
+}
+
+func NewRegistry() *Registry {
+	return &Registry{handlers: make(map[string]Handler)}
+}
+
+// Set the handler of a command
+func (registry *Registry) Register(cmd *kingpin.CmdClause, handler Handler) {
+	registry.handlers[cmd.FullCommand()] = handler
+}
+
+// Parse the arguments and run the chosen command exiting on error
+func (registry *Registry) Run(app *kingpin.Application, args []string) {
+	var cmd = kingpin.MustParse(app.Parse(args))
+
+	if !IsFolder(GetConfigDirectory()) {
+		err := os.MkdirAll(GetConfigDirectory(), 0700)
+		if err != nil {
+			Die(err.Error())
+		}
+	}
+
+	handler, ok := registry.handlers[cmd]
+	if !ok {
+		app.Usage(args)
+		os.Exit(1)
+	}
+	var ctx = &Context{ConfigPath: GetConfigFilaName()}
+	var err = handler(ctx)
+	if closeErr := ctx.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		Die(err.Error())
+	}
+}
+
+// A string flag that remembers whether it was given so an empty value can
+// clear a setting rather than leave it unchanged
+type OptionalString struct {
+	value string
+	given bool
+}
+
+func (flag *OptionalString) Set(value string) error {
+	flag.value = value
+	flag.given = true
+	return nil
+}
+
+func (flag *OptionalString) String() string {
+	return flag.value
+}
+
+// The value and whether the flag was given
+func (flag *OptionalString) Get() (string, bool) {
+	return flag.value, flag.given
+}
+
+// Add an optional string flag to a command
+func OptionalStringFlag(cmd *kingpin.CmdClause, name string, help string) *OptionalString {
+	var flag = &OptionalString{}
+	cmd.Flag(name, help).SetValue(flag)
+	return flag
+}
@@ -2,14 +2,26 @@ package common
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 
 	"github.com/howeyc/gopass"
+
+	"github.com/jbester/pwdb/pkg/pwdb"
+	"github.com/jbester/pwdb/pkg/pwgen"
 )
 
+// How long to wait for another process to release the database
+const LockTimeout = 5 * time.Minute
+
+// Layout of the times shown to the user
+const TimeFormat = "2006-01-02 15:04:05"
+
 func Die(msg string) {
 	fmt.Println(msg)
 	os.Exit(1)
@@ -21,6 +33,18 @@ func Prompt(prompt string) (string, error) {
 	return b.ReadString('\n')
 }
 
+// The account name argument prompting for it if it wasn't given
+func AccountName(name string) (string, error) {
+	if name != "" {
+		return name, nil
+	}
+	name, err := Prompt("Account name: ")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(name), nil
+}
+
 func GetConfigFilaName() string {
 	return filepath.Join(GetConfigDirectory(), "accounts")
 }
@@ -56,11 +80,17 @@ func GetNewPassword() ([]byte, error) {
 	var password []byte
 	var err error
 	for !done {
-		fmt.Printf("Enter the passphrase (empty for no passphrase): ")
+		fmt.Printf("Enter the passphrase (empty for no passphrase, ? for a suggestion): ")
 		password, err = gopass.GetPasswd()
 		if err != nil {
 			return nil, err
 		}
+		if string(password) == "?" {
+			if err = SuggestPassphrase(); err != nil {
+				return nil, err
+			}
+			continue
+		}
 		if string(password) != "" {
 			fmt.Printf("Enter the same passphrase again: ")
 			password2, err := gopass.GetPasswd()
@@ -78,3 +108,60 @@ func GetNewPassword() ([]byte, error) {
 	}
 	return password, nil
 }
+
+// Lock the database, telling the user if it's held by another process
+func LockConfig(path string) (*pwdb.Lock, error) {
+	lock, err := pwdb.LockConfig(path, 0)
+	if errors.Is(err, pwdb.LockedError) {
+		fmt.Println("Waiting for another process to release the database")
+		lock, err = pwdb.LockConfig(path, LockTimeout)
+	}
+	return lock, err
+}
+
+// Ask for the passphrase of an existing database
+func GetPassphrase() ([]byte, error) {
+	fmt.Printf("Enter password: ")
+	return gopass.GetPasswd()
+}
+
+// Lock and open the database prompting for the passphrase if it's encrypted
+func OpenVault(path string) (*pwdb.Vault, error) {
+	lock, err := LockConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	vault, err := pwdb.OpenLocked(lock, pwdb.UnlockerFunc(GetPassphrase))
+	if err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+	return vault, nil
+}
+
+// Save the vault asking for a passphrase if the database is being created
+func SaveVault(vault *pwdb.Vault) error {
+	if vault.IsNew() {
+		fmt.Printf("Saving configuration to %v\n", vault.Path())
+		password, err := GetNewPassword()
+		if err != nil {
+			return err
+		}
+		vault.ChangePassphrase(password)
+	}
+	return vault.Save()
+}
+
+// Print a randomly generated passphrase for the user to adopt
+func SuggestPassphrase() error {
+	passphrase, err := pwgen.GeneratePassphrase(pwgen.DefaultPassphrasePolicy)
+	if err != nil {
+		return err
+	}
+	bits, err := pwgen.PassphraseEntropy(pwgen.DefaultPassphrasePolicy)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Suggested passphrase (%.0f bits): %v\n", bits, passphrase)
+	return nil
+}
@@ -0,0 +1,487 @@
+package otp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/howeyc/gopass"
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/jbester/pwdb/cmd/common"
+	"github.com/jbester/pwdb/pkg/pwdb"
+	"github.com/jbester/pwdb/pkg/totp"
+)
+
+// Seconds before the end of a step the next token is shown
+const showNextToken = 5
+
+// Remaining backup codes below which a warning is shown
+const lowBackupCodes = 3
+
+// Token settings for accounts that don't use the defaults
+type TokenFlags struct {
+	algorithm *string
+	digits    *int
+	period    *int64
+	hotp      *bool
+	counter   *uint64
+	t0        *int64
+	offset    *int64
+	encoding  *string
+	alphabet  *string
+	ocra      *string
+}
+
+func AddTokenFlags(cmd *kingpin.CmdClause) TokenFlags {
+	return TokenFlags{
+		algorithm: cmd.Flag("algorithm", "HMAC algorithm").Default(string(totp.SHA1)).
+			Enum(string(totp.SHA1), string(totp.SHA256), string(totp.SHA512)),
+		digits:  cmd.Flag("digits", "Token length (6-10 digits, 5 for steam)").Int(),
+		period:  cmd.Flag("period", "Seconds each token is valid").Default("30").Int64(),
+		hotp:    cmd.Flag("hotp", "Counter based (hotp) account").Bool(),
+		counter: cmd.Flag("counter", "Counter of the next hotp token").Uint64(),
+		t0:      cmd.Flag("t0", "Unix time totp steps are counted from").Int64(),
+		offset:  cmd.Flag("offset", "Seconds added to the clock").Int64(),
+		encoding: cmd.Flag("encoding", "How codes are shown").Default(totp.DecimalEncoding).
+			Enum(totp.DecimalEncoding, totp.SteamEncoding, totp.AlphabetEncoding),
+		alphabet: cmd.Flag("alphabet", "Symbols of the alphabet encoding").String(),
+		ocra:     cmd.Flag("ocra", "Challenge-response (ocra) suite e.g. OCRA-1:HOTP-SHA1-6:QN08").String(),
+	}
+}
+
+// Build an entry from the flags
+func (flags TokenFlags) Entry(secret string) pwdb.TotpEntry {
+	if *flags.ocra != "" {
+		return pwdb.TotpEntry{Type: pwdb.OcraType, Secret: secret, Suite: *flags.ocra, Counter: *flags.counter}
+	}
+	if *flags.hotp {
+		var entry = NewEntry(secret, totp.Algorithm(*flags.algorithm), *flags.digits, 0)
+		entry.Type = pwdb.HotpType
+		entry.Counter = *flags.counter
+		return entry
+	}
+	var entry = NewEntry(secret, totp.Algorithm(*flags.algorithm), *flags.digits, *flags.period)
+	entry.T0 = *flags.t0
+	entry.Offset = *flags.offset
+	if *flags.encoding != totp.DecimalEncoding {
+		// NewEntry drops the decimal default which isn't this encoding's default
+		entry.Encoding = *flags.encoding
+		entry.Digits = *flags.digits
+	}
+	if *flags.encoding == totp.AlphabetEncoding {
+		entry.Alphabet = *flags.alphabet
+	}
+	return entry
+}
+
+// Build an entry storing only the settings that differ from the defaults
+func NewEntry(secret string, algorithm totp.Algorithm, digits int, period int64) pwdb.TotpEntry {
+	var entry = pwdb.TotpEntry{Secret: secret}
+	if algorithm != "" && algorithm != totp.SHA1 {
+		entry.Algorithm = string(algorithm)
+	}
+	if digits != 0 && digits != totp.DefaultDigits {
+		entry.Digits = digits
+	}
+	if period != 0 && period != 30 {
+		entry.Period = period
+	}
+	return entry
+}
+
+// Build an entry from an otpauth URI returning it with the URI's label
+func EntryFromURI(uri string) (pwdb.TotpEntry, string, error) {
+	key, err := totp.ParseURI(uri)
+	if err != nil {
+		return pwdb.TotpEntry{}, "", err
+	}
+	var entry = NewEntry(key.Secret.Base32(), key.Algorithm, key.Digits, key.TimeStep)
+	if key.Type == totp.TypeHOTP {
+		entry = NewEntry(key.Secret.Base32(), key.Algorithm, key.Digits, 0)
+		entry.Type = pwdb.HotpType
+		entry.Counter = key.Counter
+	} else if key.Encoder == totp.Steam {
+		// NewEntry drops the decimal default which isn't Steam's default
+		entry.Encoding = totp.SteamEncoding
+		entry.Digits = key.Digits
+	}
+	entry.Issuer = key.Issuer
+	var label = key.Account
+	if key.Issuer != "" {
+		label = key.Issuer + ":" + key.Account
+	}
+	return entry, label, nil
+}
+
+// decode the secret of an entry
+func entrySecret(entry pwdb.TotpEntry) (totp.Secret, error) {
+	// remove whitespace
+	var trimmedSecret = strings.TrimSpace(entry.Secret)
+
+	// create secret
+	totpSecret, err := totp.Base32Secret(trimmedSecret)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create totp generator")
+	}
+	return totpSecret, nil
+}
+
+// Create the generator for an entry
+func NewGenerator(entry pwdb.TotpEntry) (totp.Generator, error) {
+	totpSecret, err := entrySecret(entry)
+	if err != nil {
+		return totp.Generator{}, err
+	}
+
+	// create the generator
+	var generator = totp.NewGenerator(totpSecret)
+	if entry.Algorithm != "" {
+		generator.Algorithm = totp.Algorithm(entry.Algorithm)
+	}
+	if entry.Period != 0 {
+		generator.TimeStep = entry.Period
+	}
+	generator.T0 = entry.T0
+	if generator.Encoder, err = totp.NewEncoder(entry.Encoding, entry.Alphabet); err != nil {
+		return totp.Generator{}, err
+	}
+	generator.Digits = generator.Encoder.DefaultLength()
+	if entry.Digits != 0 {
+		generator.Digits = entry.Digits
+	}
+	if entry.Offset != 0 {
+		generator.Clock = totp.OffsetClock(totp.SystemClock, time.Duration(entry.Offset)*time.Second)
+	}
+	return generator, nil
+}
+
+// Create the generator for a counter based entry
+func NewHotpGenerator(entry pwdb.TotpEntry) (totp.HotpGenerator, error) {
+	totpSecret, err := entrySecret(entry)
+	if err != nil {
+		return totp.HotpGenerator{}, err
+	}
+	var generator = totp.NewHotpGenerator(totpSecret, entry.Counter)
+	if entry.Algorithm != "" {
+		generator.Algorithm = totp.Algorithm(entry.Algorithm)
+	}
+	if entry.Digits != 0 {
+		generator.Digits = entry.Digits
+	}
+	return generator, nil
+}
+
+// Create the generator for a challenge-response entry
+func NewOcraGenerator(entry pwdb.TotpEntry) (totp.OcraGenerator, error) {
+	totpSecret, err := entrySecret(entry)
+	if err != nil {
+		return totp.OcraGenerator{}, err
+	}
+	suite, err := totp.ParseOcraSuite(entry.Suite)
+	if err != nil {
+		return totp.OcraGenerator{}, err
+	}
+	return totp.NewOcraGenerator(suite, totpSecret), nil
+}
+
+// Check a token can be generated for the entry
+func Validate(entry pwdb.TotpEntry) error {
+	if entry.IsOcra() {
+		_, err := NewOcraGenerator(entry)
+		return err
+	}
+	if entry.IsHotp() {
+		generator, err := NewHotpGenerator(entry)
+		if err != nil {
+			return err
+		}
+		_, err = generator.Calculate(entry.Counter)
+		return err
+	}
+	generator, err := NewGenerator(entry)
+	if err != nil {
+		return err
+	}
+	_, err = generator.CodeNow()
+	return err
+}
+
+// Issue the next token of a counter based account.  The advanced counter is
+// saved before the token is printed so a token is never issued twice.
+func DoGenerateHotp(vault *pwdb.Vault, name string, entry pwdb.TotpEntry) error {
+	generator, err := NewHotpGenerator(entry)
+	if err != nil {
+		return err
+	}
+	token, err := generator.Next()
+	if err != nil {
+		return err
+	}
+	entry.Counter = generator.Counter
+	vault.PutTotp(name, entry)
+	if err = vault.Save(); err != nil {
+		return err
+	}
+	fmt.Println(generator.Format(token))
+	return nil
+}
+
+// Answer an ocra challenge.  A counter is advanced and saved before the
+// response is printed as with hotp accounts.
+func DoOcra(vault *pwdb.Vault, name string, entry pwdb.TotpEntry, challenge string, session string) error {
+	generator, err := NewOcraGenerator(entry)
+	if err != nil {
+		return err
+	}
+	var input = totp.OcraInput{
+		Challenge: challenge,
+		Counter:   entry.Counter,
+		Time:      time.Now().Add(time.Duration(entry.Offset) * time.Second),
+	}
+	if input.Session, err = hex.DecodeString(session); err != nil {
+		return errors.Wrap(err, "invalid session information")
+	}
+	if generator.Suite.PinHash != "" {
+		fmt.Printf("PIN: ")
+		pin, err := gopass.GetPasswd()
+		if err != nil {
+			return err
+		}
+		if input.PinHash, err = generator.Suite.HashPin(string(pin)); err != nil {
+			return err
+		}
+	}
+
+	response, err := generator.Calculate(input)
+	if err != nil {
+		return err
+	}
+	if generator.Suite.Counter {
+		entry.Counter++
+		vault.PutTotp(name, entry)
+		if err = vault.Save(); err != nil {
+			return err
+		}
+	}
+	fmt.Println(response)
+	return nil
+}
+
+func DoGenerate(entry pwdb.TotpEntry) error {
+	if entry.IsOcra() {
+		return errors.New("ocra responses need a challenge; use the ocra command")
+	}
+	// if no secret passed in - ask for one
+	if entry.Secret == "" {
+		s, err := common.Prompt("Enter secret: ")
+		if err != nil {
+			return errors.Wrap(err, "cannot process input")
+		}
+		entry.Secret = s
+	}
+
+	if entry.IsHotp() {
+		generator, err := NewHotpGenerator(entry)
+		if err != nil {
+			return err
+		}
+		token, err := generator.Calculate(generator.Counter)
+		if err != nil {
+			return err
+		}
+		fmt.Println(generator.Format(token))
+		return nil
+	}
+
+	generator, err := NewGenerator(entry)
+	if err != nil {
+		return err
+	}
+
+	// generate the current code
+	code, err := generator.CodeNow()
+	if err != nil {
+		return err
+	}
+	fmt.Println(code)
+	return nil
+}
+
+// a totp account shown by watch
+type watchedAccount struct {
+	name      string
+	generator totp.Generator
+}
+
+// the totp accounts whose names contain any of the filters
+func WatchedAccounts(vault *pwdb.Vault, filters []string) ([]watchedAccount, error) {
+	var accounts []watchedAccount
+	for _, name := range vault.ListTotp() {
+		entry, _ := vault.GetTotp(name)
+		if !entry.IsTotp() || !matchesAny(name, filters) {
+			continue
+		}
+		generator, err := NewGenerator(entry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "account %v", name)
+		}
+		accounts = append(accounts, watchedAccount{name, generator})
+	}
+	return accounts, nil
+}
+
+// case insensitive substring match; everything matches no filters
+func matchesAny(name string, filters []string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, filter := range filters {
+		if strings.Contains(strings.ToLower(name), strings.ToLower(filter)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redraw the tokens every second; the next token is shown as the current
+// one is about to expire
+func DoWatch(accounts []watchedAccount) error {
+	var width = 0
+	for _, account := range accounts {
+		if len(account.name) > width {
+			width = len(account.name)
+		}
+	}
+	for {
+		// clear the screen
+		fmt.Print("\033[H\033[2J")
+		for _, account := range accounts {
+			var generator = account.generator
+			var now = generator.Time()
+			code, err := generator.Code(now)
+			if err != nil {
+				return errors.Wrapf(err, "account %v", account.name)
+			}
+			var end = generator.StepEnd(now)
+			var remaining = int64(end.Sub(now).Seconds() + 0.5)
+			fmt.Printf("%-*v  %v  %3ds", width, account.name, code, remaining)
+			if end.Sub(now) < showNextToken*time.Second {
+				next, err := generator.Code(end)
+				if err != nil {
+					return errors.Wrapf(err, "account %v", account.name)
+				}
+				fmt.Printf("  next %v", next)
+			}
+			fmt.Println()
+		}
+		// wake on the next second boundary so steps change on time
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	}
+}
+
+// list an account's backup codes
+func PrintBackupCodes(entry pwdb.TotpEntry) {
+	for _, code := range entry.BackupCodes {
+		if code.Used {
+			fmt.Printf("%v\tused %v\n", code.Code, code.UsedAt.Local().Format(common.TimeFormat))
+		} else {
+			fmt.Printf("%v\tunused\n", code.Code)
+		}
+	}
+	fmt.Printf("%d of %d unused\n", entry.UnusedBackupCodes(), len(entry.BackupCodes))
+}
+
+// Mark a backup code used printing it when it's the next unused code
+func DoUseBackupCode(vault *pwdb.Vault, name string, entry pwdb.TotpEntry, code string) error {
+	if code == "" {
+		for _, backupCode := range entry.BackupCodes {
+			if !backupCode.Used {
+				code = backupCode.Code
+				fmt.Println(code)
+				break
+			}
+		}
+		if code == "" {
+			return errors.New("no unused backup codes")
+		}
+	}
+	if err := entry.UseBackupCode(code, time.Now()); err != nil {
+		return err
+	}
+	vault.PutTotp(name, entry)
+	if err := vault.Save(); err != nil {
+		return err
+	}
+	if remaining := entry.UnusedBackupCodes(); remaining < lowBackupCodes {
+		fmt.Fprintf(os.Stderr, "Warning: only %d unused backup codes remain for %v\n", remaining, name)
+	}
+	return nil
+}
+
+// The otpauth URI of a totp or hotp account
+func EntryURI(name string, entry pwdb.TotpEntry) (string, error) {
+	var label = name
+	if entry.Issuer != "" {
+		label = strings.TrimPrefix(label, entry.Issuer+":")
+	}
+	if entry.IsOcra() {
+		return "", errors.New("otpauth URIs can't describe ocra accounts")
+	}
+	if entry.IsHotp() {
+		generator, err := NewHotpGenerator(entry)
+		if err != nil {
+			return "", err
+		}
+		return generator.URI(entry.Issuer, label), nil
+	}
+	generator, err := NewGenerator(entry)
+	if err != nil {
+		return "", err
+	}
+	return generator.URI(entry.Issuer, label), nil
+}
+
+// Fields of password entries holding one time password accounts
+const (
+	URIField   = "otpauth"
+	SuiteField = "ocra suite"
+)
+
+// A password entry holding a one time password account; the secret is the
+// password and the other settings are kept in fields
+func PasswordFromEntry(name string, entry pwdb.TotpEntry) (pwdb.PasswordEntry, error) {
+	var password = pwdb.PasswordEntry{Password: entry.Secret}
+	if entry.IsOcra() {
+		password.SetField(SuiteField, entry.Suite, false)
+	} else {
+		uri, err := EntryURI(name, entry)
+		if err != nil {
+			return password, err
+		}
+		password.SetField(URIField, uri, true)
+	}
+	if len(entry.BackupCodes) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: the backup codes of %v aren't copied\n", name)
+	}
+	return password, nil
+}
+
+// The one time password account held by a password entry; without an
+// otpauth URI field the password is taken as a default totp secret
+func EntryFromPassword(password pwdb.PasswordEntry) (pwdb.TotpEntry, error) {
+	var entry = pwdb.TotpEntry{Secret: strings.TrimSpace(password.Password)}
+	if field, ok := password.Field(URIField); ok {
+		var err error
+		if entry, _, err = EntryFromURI(field.Value); err != nil {
+			return entry, err
+		}
+	} else if field, ok := password.Field(SuiteField); ok {
+		entry.Type = pwdb.OcraType
+		entry.Suite = field.Value
+	}
+	return entry, Validate(entry)
+}
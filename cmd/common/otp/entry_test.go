@@ -0,0 +1,32 @@
+package otp
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/jbester/pwdb/pkg/totp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSteamEntryURIRoundTrip(t *testing.T) {
+	for _, digits := range []int{5, 6} {
+		var uri = "otpauth://totp/Steam:me?secret=JBSWY3DPEHPK3PXP&issuer=Steam&encoder=steam&digits=" +
+			strconv.Itoa(digits)
+		entry, _, err := EntryFromURI(uri)
+		assert.NoError(t, err)
+		assert.Equal(t, totp.SteamEncoding, entry.Encoding)
+
+		generator, err := NewGenerator(entry)
+		assert.NoError(t, err)
+		code, err := generator.CodeNow()
+		assert.NoError(t, err)
+		assert.Len(t, code, digits)
+
+		exported, err := EntryURI("Steam:me", entry)
+		assert.NoError(t, err)
+		assert.Contains(t, exported, "digits="+strconv.Itoa(digits))
+		reimported, _, err := EntryFromURI(exported)
+		assert.NoError(t, err)
+		assert.Equal(t, entry, reimported)
+	}
+}
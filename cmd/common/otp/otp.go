@@ -0,0 +1,454 @@
+// One time password commands shared by pwdb and totpcmd
+package otp
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jbester/pwdb/cmd/common"
+	"github.com/jbester/pwdb/pkg/pwdb"
+	"github.com/jbester/pwdb/pkg/totp"
+)
+
+// Add the one time password commands
+func Register(parent common.Commander, registry *common.Registry) {
+	var generate = parent.Command("generate", "Generate a token for an account; hotp counters are saved")
+	var generateAccount = generate.Arg("account", "Account name").String()
+	var generateFlags = AddTokenFlags(generate)
+	registry.Register(generate, func(ctx *common.Context) error {
+		if *generateAccount == "" {
+			return DoGenerate(generateFlags.Entry(""))
+		}
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		_, ok := vault.GetTotp(*generateAccount)
+		var isHotp = func(name string) bool {
+			entry, _ := vault.GetTotp(name)
+			return entry.IsHotp()
+		}
+		name, err := common.ResolveAccount(*generateAccount, ok, vault.SearchTotp(*generateAccount), isHotp)
+		if err != nil {
+			return err
+		}
+		entry, _ := vault.GetTotp(name)
+		if entry.IsHotp() {
+			return DoGenerateHotp(vault, name, entry)
+		}
+		return DoGenerate(entry)
+	})
+
+	var search = parent.Command("search", "Find accounts by name or issuer")
+	var searchQuery = search.Arg("query", "Text to look for").Required().String()
+	registry.Register(search, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		common.PrintMatches(vault.SearchTotp(*searchQuery))
+		return nil
+	})
+
+	var add = parent.Command("add", "Add a new totp or hotp account")
+	var addAccount = add.Arg("account", "Account name").String()
+	var addFlags = AddTokenFlags(add)
+	var addURI = add.Flag("uri", "otpauth:// URI of the account instead of prompting for the secret").String()
+	registry.Register(add, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		var entry pwdb.TotpEntry
+		var accountName = *addAccount
+		if *addURI != "" {
+			var label string
+			if entry, label, err = EntryFromURI(*addURI); err != nil {
+				return err
+			}
+			if accountName == "" {
+				accountName = label
+			}
+		}
+		if accountName, err = common.AccountName(accountName); err != nil {
+			return err
+		}
+		accountName = pwdb.CleanName(accountName)
+		if _, ok := vault.GetTotp(accountName); ok {
+			return fmt.Errorf("Account named '%v' already exists", accountName)
+		}
+
+		if *addURI == "" {
+			secret, err := common.Prompt("Secret: ")
+			if err != nil {
+				return err
+			}
+			entry = addFlags.Entry(strings.TrimSpace(secret))
+		}
+		if err = Validate(entry); err != nil {
+			return err
+		}
+
+		vault.PutTotp(accountName, entry)
+		return common.SaveVault(vault)
+	})
+
+	var export = parent.Command("export", "Export a totp account")
+	var exportAccount = export.Arg("account", "Account name").Required().String()
+	var exportURI = export.Flag("uri", "Print an otpauth:// URI rather than the settings").Default("true").Bool()
+	registry.Register(export, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		entry, ok := vault.GetTotp(*exportAccount)
+		if !ok {
+			return fmt.Errorf("No account found")
+		}
+		return DoExport(*exportAccount, entry, *exportURI)
+	})
+
+	var remove = parent.Command("remove", "Remove a totp account")
+	var removeAccount = remove.Arg("account", "Account name").String()
+	var removeRecursive = remove.Flag("recursive", "Remove every account in the folder").Short('r').Bool()
+	registry.Register(remove, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		accountName, err := common.AccountName(*removeAccount)
+		if err != nil {
+			return err
+		}
+		if *removeRecursive {
+			var count = vault.DeleteTotpFolder(accountName)
+			if count == 0 {
+				return fmt.Errorf("No folder named '%v'", accountName)
+			}
+			fmt.Printf("Removed %d accounts\n", count)
+			return vault.Save()
+		}
+		if vault.DeleteTotp(accountName) {
+			return vault.Save()
+		}
+		return nil
+	})
+
+	var edit = parent.Command("edit", "Change a one time password account")
+	var editAccount = edit.Arg("account", "Account name").Required().String()
+	var editIssuer = common.OptionalStringFlag(edit, "issuer", "New issuer; empty to clear")
+	var editSecret = edit.Flag("secret", "Prompt for a new secret").Bool()
+	var editAlgorithm = edit.Flag("algorithm", "New HMAC algorithm").
+		Enum(string(totp.SHA1), string(totp.SHA256), string(totp.SHA512))
+	var editDigits = edit.Flag("digits", "New token length").Int()
+	var editPeriod = edit.Flag("period", "New seconds each token is valid").Int64()
+	registry.Register(edit, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		entry, ok := vault.GetTotp(*editAccount)
+		if !ok {
+			return fmt.Errorf("No account found")
+		}
+		var changed = false
+		if issuer, ok := editIssuer.Get(); ok {
+			entry.Issuer = issuer
+			changed = true
+		}
+		if *editSecret {
+			secret, err := common.Prompt("Secret: ")
+			if err != nil {
+				return err
+			}
+			entry.Secret = strings.TrimSpace(secret)
+			changed = true
+		}
+		if *editAlgorithm != "" {
+			entry.Algorithm = *editAlgorithm
+			changed = true
+		}
+		if *editDigits != 0 {
+			entry.Digits = *editDigits
+			changed = true
+		}
+		if *editPeriod != 0 {
+			entry.Period = *editPeriod
+			changed = true
+		}
+		if !changed {
+			return fmt.Errorf("Nothing to change")
+		}
+		if err = Validate(entry); err != nil {
+			return err
+		}
+		vault.PutTotp(*editAccount, entry)
+		return common.SaveVault(vault)
+	})
+
+	var rename = parent.Command("rename", "Rename a one time password account")
+	var renameFrom = rename.Arg("account", "Account name").Required().String()
+	var renameTo = rename.Arg("to", "New account name").Required().String()
+	registry.Register(rename, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		if err = renameTotp(vault, *renameFrom, *renameTo); err != nil {
+			return err
+		}
+		return common.SaveVault(vault)
+	})
+
+	registerTransfer(parent, registry, "copy", "Copy a one time password account", false)
+	registerTransfer(parent, registry, "move", "Move a one time password account", true)
+
+	var list = parent.Command("list", "List the accounts in a folder")
+	var listFolder = list.Arg("folder", "Folder; every account if not given").String()
+	var listRecursive = list.Flag("recursive", "List the accounts in subfolders").Short('r').Bool()
+	registry.Register(list, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		return common.PrintTree(vault.ListTotp(), *listFolder, *listRecursive)
+	})
+
+	var offset = parent.Command("offset", "Show or set the clock offset of a totp account")
+	var offsetAccount = offset.Arg("account", "Account name").Required().String()
+	var offsetSeconds = offset.Arg("seconds", "Seconds added to the clock; use -- before a negative offset").String()
+	registry.Register(offset, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		entry, ok := vault.GetTotp(*offsetAccount)
+		if !ok || entry.IsHotp() {
+			return fmt.Errorf("No totp or ocra account found")
+		}
+		if *offsetSeconds == "" {
+			fmt.Printf("Clock offset: %ds\n", entry.Offset)
+			return nil
+		}
+		seconds, err := strconv.ParseInt(*offsetSeconds, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid offset '%v'", *offsetSeconds)
+		}
+		entry.Offset = seconds
+		vault.PutTotp(*offsetAccount, entry)
+		return vault.Save()
+	})
+
+	var watch = parent.Command("watch", "Show the current totp tokens until interrupted")
+	var watchFilters = watch.Arg("filter", "Only show accounts containing the text").Strings()
+	registry.Register(watch, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		accounts, err := WatchedAccounts(vault, *watchFilters)
+		if err != nil {
+			return err
+		}
+		if len(accounts) == 0 {
+			return fmt.Errorf("No account found")
+		}
+		// the tokens only need the secrets so don't hold the lock while watching
+		vault.Close()
+		return DoWatch(accounts)
+	})
+
+	var ocra = parent.Command("ocra", "Answer the challenge of an ocra account; counters are saved")
+	var ocraAccount = ocra.Arg("account", "Account name").Required().String()
+	var ocraChallenge = ocra.Arg("challenge", "Challenge").Required().String()
+	var ocraSession = ocra.Flag("session", "Hex encoded session information").String()
+	registry.Register(ocra, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		entry, ok := vault.GetTotp(*ocraAccount)
+		if !ok || !entry.IsOcra() {
+			return fmt.Errorf("No ocra account found")
+		}
+		return DoOcra(vault, *ocraAccount, entry, *ocraChallenge, *ocraSession)
+	})
+
+	var backupCodes = parent.Command("backup-codes", "List or add the backup codes of an account")
+	var backupAccount = backupCodes.Arg("account", "Account name").Required().String()
+	var backupAdd = backupCodes.Flag("add", "Backup code to add (repeatable)").Strings()
+	var backupReplace = backupCodes.Flag("replace", "Replace the existing codes with the added ones").Bool()
+	registry.Register(backupCodes, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		entry, ok := vault.GetTotp(*backupAccount)
+		if !ok {
+			return fmt.Errorf("No account found")
+		}
+		if len(*backupAdd) == 0 && !*backupReplace {
+			PrintBackupCodes(entry)
+			return nil
+		}
+		if *backupReplace {
+			entry.BackupCodes = nil
+		}
+		for _, code := range *backupAdd {
+			entry.BackupCodes = append(entry.BackupCodes, pwdb.BackupCode{Code: strings.TrimSpace(code)})
+		}
+		vault.PutTotp(*backupAccount, entry)
+		return vault.Save()
+	})
+
+	var useBackup = parent.Command("use-backup-code", "Mark a backup code used")
+	var useAccount = useBackup.Arg("account", "Account name").Required().String()
+	var useCode = useBackup.Arg("code", "Backup code; the next unused code if not given").String()
+	registry.Register(useBackup, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		entry, ok := vault.GetTotp(*useAccount)
+		if !ok {
+			return fmt.Errorf("No account found")
+		}
+		return DoUseBackupCode(vault, *useAccount, entry, *useCode)
+	})
+}
+
+// rename an account or folder reporting errors as the other commands do
+func renameTotp(vault *pwdb.Vault, from string, to string) error {
+	to = pwdb.CleanName(to)
+	var err = vault.RenameTotp(from, to)
+	if err == pwdb.NoEntryError {
+		err = vault.MoveTotpFolder(from, to)
+	}
+	switch err {
+	case pwdb.NoEntryError:
+		return fmt.Errorf("No account found")
+	case pwdb.EntryExistsError:
+		return fmt.Errorf("Account named '%v' already exists", to)
+	default:
+		return err
+	}
+}
+
+// Add a command copying or moving a one time password account within the
+// one time passwords or into the passwords
+func registerTransfer(parent common.Commander, registry *common.Registry, name string, help string, move bool) {
+	var cmd = parent.Command(name, help)
+	var from = cmd.Arg("account", "Account name").Required().String()
+	var to = cmd.Arg("to", "New account name; the same name if not given with --pass").String()
+	var toPass = cmd.Flag("pass", "Into the passwords; the secret is the password").Bool()
+	registry.Register(cmd, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		// folders can be moved within the one time passwords
+		entry, ok := vault.GetTotp(*from)
+		if !ok && (*toPass || !move) {
+			return fmt.Errorf("No account found")
+		}
+		var destination = pwdb.CleanName(*to)
+		if destination == "" {
+			if !*toPass {
+				return fmt.Errorf("No new account name given")
+			}
+			destination = *from
+		}
+
+		switch {
+		case *toPass:
+			if _, exists := vault.GetPassword(destination); exists {
+				return fmt.Errorf("Account named '%v' already exists", destination)
+			}
+			password, err := PasswordFromEntry(*from, entry)
+			if err != nil {
+				return err
+			}
+			vault.PutPassword(destination, password)
+			if move {
+				vault.DeleteTotp(*from)
+			}
+		case move:
+			if err = renameTotp(vault, *from, destination); err != nil {
+				return err
+			}
+		default:
+			if _, exists := vault.GetTotp(destination); exists {
+				return fmt.Errorf("Account named '%v' already exists", destination)
+			}
+			entry.BackupCodes = append([]pwdb.BackupCode(nil), entry.BackupCodes...)
+			vault.PutTotp(destination, entry)
+		}
+		return common.SaveVault(vault)
+	})
+}
+
+// Print an account as an otpauth URI or its settings
+func DoExport(name string, entry pwdb.TotpEntry, uri bool) error {
+	if uri && !entry.IsOcra() {
+		if entry.Encoding == totp.AlphabetEncoding {
+			fmt.Fprintln(os.Stderr, "Warning: otpauth URIs can't describe the account's alphabet")
+		}
+		uri, err := EntryURI(name, entry)
+		if err != nil {
+			return err
+		}
+		fmt.Println(uri)
+		return nil
+	}
+	if entry.IsOcra() {
+		// otpauth URIs can't describe ocra accounts so print the settings
+		fmt.Println("Type:", pwdb.OcraType)
+		fmt.Println("Secret:", entry.Secret)
+		fmt.Println("Suite:", entry.Suite)
+		fmt.Println("Counter:", entry.Counter)
+		return nil
+	}
+	if entry.IsHotp() {
+		generator, err := NewHotpGenerator(entry)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Type:", pwdb.HotpType)
+		fmt.Println("Secret:", generator.Secret.Base32())
+		if entry.Issuer != "" {
+			fmt.Println("Issuer:", entry.Issuer)
+		}
+		fmt.Println("Algorithm:", generator.Algorithm)
+		fmt.Println("Digits:", generator.Digits)
+		fmt.Println("Counter:", generator.Counter)
+		return nil
+	}
+
+	generator, err := NewGenerator(entry)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Type:", pwdb.TotpType)
+	fmt.Println("Secret:", generator.Secret.Base32())
+	if entry.Issuer != "" {
+		fmt.Println("Issuer:", entry.Issuer)
+	}
+	fmt.Println("Algorithm:", generator.Algorithm)
+	fmt.Println("Digits:", generator.Digits)
+	fmt.Println("Period:", generator.TimeStep)
+	if entry.Encoding != "" {
+		fmt.Println("Encoding:", entry.Encoding)
+	}
+	if entry.Alphabet != "" {
+		fmt.Println("Alphabet:", entry.Alphabet)
+	}
+	if entry.T0 != 0 {
+		fmt.Println("T0:", entry.T0)
+	}
+	if entry.Offset != 0 {
+		fmt.Printf("Clock offset: %ds\n", entry.Offset)
+	}
+	return nil
+}
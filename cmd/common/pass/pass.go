@@ -0,0 +1,551 @@
+// Password commands shared by pwdb and pwcmd
+package pass
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/howeyc/gopass"
+
+	"github.com/jbester/pwdb/cmd/common"
+	"github.com/jbester/pwdb/cmd/common/otp"
+	"github.com/jbester/pwdb/pkg/pwdb"
+	"github.com/jbester/pwdb/pkg/pwgen"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// Add the password commands
+func Register(parent common.Commander, registry *common.Registry) {
+	var get = parent.Command("get", "Get the password for an account")
+	var getAccount = get.Arg("account", "Account Name").String()
+	var reveal = get.Flag("reveal", "Show sensitive custom fields").Short('r').Bool()
+	registry.Register(get, func(ctx *common.Context) error {
+		if *getAccount == "" {
+			return fmt.Errorf("No account given")
+		}
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		_, ok := vault.GetPassword(*getAccount)
+		name, err := common.ResolveAccount(*getAccount, ok, vault.SearchPasswords(*getAccount), nil)
+		if err != nil {
+			return err
+		}
+		entry, _ := vault.GetPassword(name)
+		PrintEntry(entry, *reveal)
+		vault.TouchPassword(name)
+		return vault.SaveAccessed()
+	})
+
+	var search = parent.Command("search", "Find accounts by name, username, URL or tag")
+	var searchQuery = search.Arg("query", "Text to look for").Required().String()
+	registry.Register(search, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		common.PrintMatches(vault.SearchPasswords(*searchQuery))
+		return nil
+	})
+
+	var add = parent.Command("add", "Add a new password")
+	var addFlags = AddEntryFlags(add)
+	var addGenerate = add.Flag("generate", "Generate the password instead of prompting for it").Short('g').Bool()
+	var addPolicy = AddPolicyFlags(add)
+	registry.Register(add, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		accountName, err := common.AccountName(*addFlags.account)
+		if err != nil {
+			return err
+		}
+		accountName = pwdb.CleanName(accountName)
+		if _, ok := vault.GetPassword(accountName); ok {
+			return fmt.Errorf("Account named '%v' already exists", accountName)
+		}
+
+		username, err := common.Prompt("Username: ")
+		if err != nil {
+			return err
+		}
+		var secret []byte
+		if *addGenerate {
+			password, bits, err := addPolicy.Generate()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Generated a password with %.0f bits of entropy\n", bits)
+			secret = []byte(password)
+		} else {
+			fmt.Printf("Password: ")
+			if secret, err = gopass.GetPasswd(); err != nil {
+				return err
+			}
+		}
+
+		var entry = pwdb.PasswordEntry{
+			Username: strings.TrimSpace(username),
+			Password: string(secret),
+		}
+		addFlags.apply(&entry)
+		vault.PutPassword(accountName, entry)
+		return common.SaveVault(vault)
+	})
+
+	var generate = parent.Command("generate", "Generate a password without saving it")
+	var generatePolicy = AddPolicyFlags(generate)
+	registry.Register(generate, func(ctx *common.Context) error {
+		password, bits, err := generatePolicy.Generate()
+		if err != nil {
+			return err
+		}
+		fmt.Println(password)
+		fmt.Printf("Entropy: %.0f bits\n", bits)
+		return nil
+	})
+
+	var remove = parent.Command("remove", "Remove a password account")
+	var removeAccount = remove.Arg("account", "Account Name").String()
+	var removeRecursive = remove.Flag("recursive", "Remove every account in the folder").Short('r').Bool()
+	registry.Register(remove, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		accountName, err := common.AccountName(*removeAccount)
+		if err != nil {
+			return err
+		}
+		if *removeRecursive {
+			var count = vault.DeletePasswordFolder(accountName)
+			if count == 0 {
+				return fmt.Errorf("No folder named '%v'", accountName)
+			}
+			fmt.Printf("Removed %d accounts\n", count)
+			return vault.Save()
+		}
+		if vault.DeletePassword(accountName) {
+			return vault.Save()
+		}
+		return nil
+	})
+
+	var edit = parent.Command("edit", "Change a password account")
+	var editAccount = edit.Arg("account", "Account Name").Required().String()
+	var editFlags = AddEditFlags(edit)
+	registry.Register(edit, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		entry, ok := vault.GetPassword(*editAccount)
+		if !ok {
+			return fmt.Errorf("No account found")
+		}
+		changed, err := editFlags.apply(&entry)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			return fmt.Errorf("Nothing to change")
+		}
+		vault.PutPassword(*editAccount, entry)
+		return common.SaveVault(vault)
+	})
+
+	var rename = parent.Command("rename", "Rename a password account")
+	var renameFrom = rename.Arg("account", "Account Name").Required().String()
+	var renameTo = rename.Arg("to", "New account name").Required().String()
+	registry.Register(rename, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		if err = renamePassword(vault, *renameFrom, *renameTo); err != nil {
+			return err
+		}
+		return common.SaveVault(vault)
+	})
+
+	var history = parent.Command("history", "List the previous passwords of an account")
+	var historyAccount = history.Arg("account", "Account Name").Required().String()
+	var historyReveal = history.Flag("reveal", "Show the passwords").Short('r').Bool()
+	registry.Register(history, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		entry, ok := vault.GetPassword(*historyAccount)
+		if !ok {
+			return fmt.Errorf("No account found")
+		}
+		if len(entry.History) == 0 {
+			fmt.Println("No previous passwords")
+		}
+		for i, previous := range entry.History {
+			var password = previous.Password
+			if !*historyReveal {
+				password = "********"
+			}
+			fmt.Printf("%d\t%v\t%v\n", i+1, previous.Changed.Local().Format(common.TimeFormat), password)
+		}
+		return nil
+	})
+
+	var revert = parent.Command("revert", "Restore a previous password of an account")
+	var revertAccount = revert.Arg("account", "Account Name").Required().String()
+	var revertIndex = revert.Arg("n", "Previous password number; 1 is the most recent").Default("1").Int()
+	registry.Register(revert, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		switch err = vault.RevertPassword(*revertAccount, *revertIndex); err {
+		case nil:
+		case pwdb.NoEntryError:
+			return fmt.Errorf("No account found")
+		case pwdb.NoHistoryError:
+			return fmt.Errorf("No previous password %d", *revertIndex)
+		default:
+			return err
+		}
+		if err = common.SaveVault(vault); err != nil {
+			return err
+		}
+		fmt.Printf("Restored previous password %d; the replaced password is now 1\n", *revertIndex)
+		return nil
+	})
+
+	registerTransfer(parent, registry, "copy", "Copy a password account", false)
+	registerTransfer(parent, registry, "move", "Move a password account", true)
+
+	var list = parent.Command("list", "List the accounts in a folder")
+	var listFolder = list.Arg("folder", "Folder; every account if not given").String()
+	var listRecursive = list.Flag("recursive", "List the accounts in subfolders").Short('r').Bool()
+	registry.Register(list, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		return common.PrintTree(vault.ListPasswords(), *listFolder, *listRecursive)
+	})
+}
+
+// rename an account or folder reporting errors as the other commands do
+func renamePassword(vault *pwdb.Vault, from string, to string) error {
+	to = pwdb.CleanName(to)
+	var err = vault.RenamePassword(from, to)
+	if err == pwdb.NoEntryError {
+		err = vault.MovePasswordFolder(from, to)
+	}
+	switch err {
+	case pwdb.NoEntryError:
+		return fmt.Errorf("No account found")
+	case pwdb.EntryExistsError:
+		return fmt.Errorf("Account named '%v' already exists", to)
+	default:
+		return err
+	}
+}
+
+// Add a command copying or moving a password account within the passwords or
+// into the one time passwords
+func registerTransfer(parent common.Commander, registry *common.Registry, name string, help string, move bool) {
+	var cmd = parent.Command(name, help)
+	var from = cmd.Arg("account", "Account Name").Required().String()
+	var to = cmd.Arg("to", "New account name; the same name if not given with --otp").String()
+	var toOtp = cmd.Flag("otp", "Into the one time password accounts; the password is the secret").Bool()
+	registry.Register(cmd, func(ctx *common.Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		// folders can be moved within the passwords
+		entry, ok := vault.GetPassword(*from)
+		if !ok && (*toOtp || !move) {
+			return fmt.Errorf("No account found")
+		}
+		var destination = pwdb.CleanName(*to)
+		if destination == "" {
+			if !*toOtp {
+				return fmt.Errorf("No new account name given")
+			}
+			destination = *from
+		}
+
+		switch {
+		case *toOtp:
+			if _, exists := vault.GetTotp(destination); exists {
+				return fmt.Errorf("Account named '%v' already exists", destination)
+			}
+			totpEntry, err := otp.EntryFromPassword(entry)
+			if err != nil {
+				return err
+			}
+			vault.PutTotp(destination, totpEntry)
+			if move {
+				vault.DeletePassword(*from)
+			}
+		case move:
+			if err = renamePassword(vault, *from, destination); err != nil {
+				return err
+			}
+		default:
+			if _, exists := vault.GetPassword(destination); exists {
+				return fmt.Errorf("Account named '%v' already exists", destination)
+			}
+			// the copy is a new entry without the previous passwords of the original
+			entry.Created = time.Time{}
+			entry.Accessed = time.Time{}
+			entry.History = nil
+			vault.PutPassword(destination, entry)
+		}
+		return common.SaveVault(vault)
+	})
+}
+
+// Options of the edit command; only the given options change the entry
+type EditFlags struct {
+	username     *common.OptionalString
+	password     *bool
+	generate     *bool
+	policy       PolicyFlags
+	urls         *[]string
+	notes        *common.OptionalString
+	tags         *[]string
+	fields       *map[string]string
+	sensitive    *map[string]string
+	removeFields *[]string
+}
+
+func AddEditFlags(cmd *kingpin.CmdClause) EditFlags {
+	return EditFlags{
+		username:     common.OptionalStringFlag(cmd, "username", "New username"),
+		password:     cmd.Flag("password", "Prompt for a new password").Bool(),
+		generate:     cmd.Flag("generate", "Generate a new password").Short('g').Bool(),
+		policy:       AddPolicyFlags(cmd),
+		urls:         cmd.Flag("url", "Site address replacing the current ones (repeatable); empty to clear").Strings(),
+		notes:        common.OptionalStringFlag(cmd, "notes", "New notes; empty to clear"),
+		tags:         cmd.Flag("tag", "Tag replacing the current ones (repeatable); empty to clear").Strings(),
+		fields:       cmd.Flag("field", "Custom field as name=value (repeatable)").StringMap(),
+		sensitive:    cmd.Flag("sensitive", "Sensitive custom field as name=value (repeatable)").StringMap(),
+		removeFields: cmd.Flag("remove-field", "Custom field to remove (repeatable)").Strings(),
+	}
+}
+
+// change the entry as the flags ask returning whether anything was given
+func (flags EditFlags) apply(entry *pwdb.PasswordEntry) (bool, error) {
+	var changed = false
+	if username, ok := flags.username.Get(); ok {
+		entry.Username = username
+		changed = true
+	}
+	if *flags.generate {
+		password, bits, err := flags.policy.Generate()
+		if err != nil {
+			return false, err
+		}
+		fmt.Printf("Generated a password with %.0f bits of entropy\n", bits)
+		entry.Password = password
+		changed = true
+	} else if *flags.password {
+		fmt.Printf("Password: ")
+		secret, err := gopass.GetPasswd()
+		if err != nil {
+			return false, err
+		}
+		entry.Password = string(secret)
+		changed = true
+	}
+	if len(*flags.urls) > 0 {
+		entry.URLs = nonEmpty(*flags.urls)
+		changed = true
+	}
+	if notes, ok := flags.notes.Get(); ok {
+		entry.Notes = notes
+		changed = true
+	}
+	if len(*flags.tags) > 0 {
+		entry.Tags = nonEmpty(*flags.tags)
+		changed = true
+	}
+	for _, name := range *flags.removeFields {
+		if !entry.RemoveField(name) {
+			return false, fmt.Errorf("No field named '%v'", name)
+		}
+		changed = true
+	}
+	if len(*flags.fields) > 0 || len(*flags.sensitive) > 0 {
+		setFields(entry, *flags.fields, false)
+		setFields(entry, *flags.sensitive, true)
+		changed = true
+	}
+	return changed, nil
+}
+
+// the values that aren't empty; nil if none are
+func nonEmpty(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// Account name and metadata options of a new entry
+type EntryFlags struct {
+	account   *string
+	urls      *[]string
+	notes     *string
+	tags      *[]string
+	fields    *map[string]string
+	sensitive *map[string]string
+}
+
+func AddEntryFlags(cmd *kingpin.CmdClause) EntryFlags {
+	return EntryFlags{
+		account:   cmd.Arg("account", "Account Name").String(),
+		urls:      cmd.Flag("url", "Site address (repeatable)").Strings(),
+		notes:     cmd.Flag("notes", "Free-form notes").String(),
+		tags:      cmd.Flag("tag", "Tag (repeatable)").Strings(),
+		fields:    cmd.Flag("field", "Custom field as name=value (repeatable)").StringMap(),
+		sensitive: cmd.Flag("sensitive", "Sensitive custom field as name=value (repeatable)").StringMap(),
+	}
+}
+
+// set the entry's metadata from the flags
+func (flags EntryFlags) apply(entry *pwdb.PasswordEntry) {
+	entry.URLs = *flags.urls
+	entry.Notes = *flags.notes
+	entry.Tags = *flags.tags
+	setFields(entry, *flags.fields, false)
+	setFields(entry, *flags.sensitive, true)
+}
+
+// Password generator options
+type PolicyFlags struct {
+	preset       *string
+	length       *int
+	noSymbols    *bool
+	noLookAlikes *bool
+	passphrase   *bool
+	words        *int
+	separator    *string
+	capitalize   *bool
+	digit        *bool
+	wordList     *string
+}
+
+func AddPolicyFlags(cmd *kingpin.CmdClause) PolicyFlags {
+	return PolicyFlags{
+		preset: cmd.Flag("policy", "Generator policy: "+strings.Join(pwgen.PresetNames(), ", ")).
+			Default("default").Enum(pwgen.PresetNames()...),
+		length:       cmd.Flag("length", "Password length overriding the policy").Int(),
+		noSymbols:    cmd.Flag("no-symbols", "Leave out symbols").Bool(),
+		noLookAlikes: cmd.Flag("no-lookalikes", "Leave out characters that look alike").Bool(),
+		passphrase:   cmd.Flag("passphrase", "Generate a passphrase of dictionary words").Bool(),
+		words:        cmd.Flag("words", "Number of passphrase words").Default("6").Int(),
+		separator:    cmd.Flag("separator", "Passphrase word separator").Default("-").String(),
+		capitalize:   cmd.Flag("capitalize", "Capitalize passphrase words").Bool(),
+		digit:        cmd.Flag("digit", "Add a digit to the passphrase").Bool(),
+		wordList:     cmd.Flag("wordlist", "Passphrase word list file instead of the EFF list").ExistingFile(),
+	}
+}
+
+// Generate a password from the flags returning it with its entropy
+func (flags PolicyFlags) Generate() (string, float64, error) {
+	if *flags.passphrase {
+		return flags.generatePassphrase()
+	}
+	policy, _ := pwgen.Preset(*flags.preset)
+	if *flags.length > 0 {
+		policy.Length = *flags.length
+	}
+	if *flags.noSymbols {
+		policy = policy.WithoutClass(pwgen.Symbols)
+	}
+	if *flags.noLookAlikes {
+		policy.ExcludeLookAlikes = true
+	}
+	password, err := pwgen.Generate(policy)
+	if err != nil {
+		return "", 0, err
+	}
+	bits, err := pwgen.Entropy(policy)
+	return password, bits, err
+}
+
+func (flags PolicyFlags) generatePassphrase() (string, float64, error) {
+	var policy = pwgen.PassphrasePolicy{
+		Words:      *flags.words,
+		Separator:  *flags.separator,
+		Capitalize: *flags.capitalize,
+		Digit:      *flags.digit,
+	}
+	if *flags.wordList != "" {
+		fp, err := os.Open(*flags.wordList)
+		if err != nil {
+			return "", 0, err
+		}
+		defer fp.Close()
+		if policy.WordList, err = pwgen.LoadWordList(fp); err != nil {
+			return "", 0, err
+		}
+	}
+	passphrase, err := pwgen.GeneratePassphrase(policy)
+	if err != nil {
+		return "", 0, err
+	}
+	bits, err := pwgen.PassphraseEntropy(policy)
+	return passphrase, bits, err
+}
+
+// add custom fields in name order
+func setFields(entry *pwdb.PasswordEntry, fields map[string]string, sensitive bool) {
+	var names = make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		entry.SetField(name, fields[name], sensitive)
+	}
+}
+
+// print an entry; sensitive custom fields are masked unless revealed
+func PrintEntry(entry pwdb.PasswordEntry, reveal bool) {
+	fmt.Println("Username:", entry.Username)
+	fmt.Println("Password:", entry.Password)
+	for _, url := range entry.URLs {
+		fmt.Println("URL:", url)
+	}
+	if len(entry.Tags) > 0 {
+		fmt.Println("Tags:", strings.Join(entry.Tags, ", "))
+	}
+	for _, field := range entry.Fields {
+		var value = field.Value
+		if field.Sensitive && !reveal {
+			value = "********"
+		}
+		fmt.Printf("%v: %v\n", field.Name, value)
+	}
+	if entry.Notes != "" {
+		fmt.Println("Notes:", entry.Notes)
+	}
+	for _, stamp := range []struct {
+		name string
+		time time.Time
+	}{{"Created", entry.Created}, {"Modified", entry.Modified}, {"Accessed", entry.Accessed}} {
+		if !stamp.time.IsZero() {
+			fmt.Printf("%v: %v\n", stamp.name, stamp.time.Local().Format(common.TimeFormat))
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jbester/pwdb/pkg/pwdb"
+)
+
+// Most accounts suggested when nothing matches well
+const MaxSuggestions = 3
+
+// The account a name refers to; the name itself if the account exists, else
+// the one account matching it well, else the user's choice of several.  A
+// lone match is only used outright if confirm is nil or returns false for it,
+// e.g. so the counter of an hotp account the user didn't name isn't advanced.
+func ResolveAccount(name string, exists bool, matches []pwdb.Match, confirm func(string) bool) (string, error) {
+	if exists {
+		return name, nil
+	}
+	var strong []string
+	var weak []string
+	for _, match := range matches {
+		if match.Strong() {
+			strong = append(strong, match.Name)
+		} else if len(weak) < MaxSuggestions {
+			weak = append(weak, match.Name)
+		}
+	}
+	switch {
+	case len(strong) == 1 && confirm != nil && confirm(strong[0]):
+		return Choose(strong)
+	case len(strong) == 1:
+		fmt.Fprintf(os.Stderr, "Using %v\n", strong[0])
+		return strong[0], nil
+	case len(strong) > 1:
+		return Choose(strong)
+	case len(weak) > 0:
+		return "", fmt.Errorf("No account found; did you mean %v?", strings.Join(weak, ", "))
+	}
+	return "", fmt.Errorf("No account found")
+}
+
+// Ask the user to pick one of several accounts
+func Choose(names []string) (string, error) {
+	for i, name := range names {
+		fmt.Printf("%3d. %v\n", i+1, name)
+	}
+	answer, err := Prompt(fmt.Sprintf("Choose [1-%d]: ", len(names)))
+	if err != nil {
+		return "", err
+	}
+	choice, err := strconv.Atoi(strings.TrimSpace(answer))
+	if err != nil || choice < 1 || choice > len(names) {
+		return "", fmt.Errorf("Invalid choice '%v'", strings.TrimSpace(answer))
+	}
+	return names[choice-1], nil
+}
+
+// Print search results best first with the field that matched
+func PrintMatches(matches []pwdb.Match) {
+	if len(matches) == 0 {
+		fmt.Println("No matches")
+		return
+	}
+	for _, match := range matches {
+		if match.Field == "Name" {
+			fmt.Println(match.Name)
+		} else {
+			fmt.Printf("%v (%v: %v)\n", match.Name, match.Field, match.Value)
+		}
+	}
+}
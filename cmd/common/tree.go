@@ -0,0 +1,65 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jbester/pwdb/pkg/pwdb"
+)
+
+// a folder of account names
+type treeNode struct {
+	children map[string]*treeNode
+	entry    bool // an account has the node's name as well as any children
+}
+
+func newTreeNode() *treeNode {
+	return &treeNode{children: make(map[string]*treeNode)}
+}
+
+// Print the accounts in a folder; subfolders are listed with a trailing slash
+// and expanded when recursive
+func PrintTree(names []string, folder string, recursive bool) error {
+	folder = pwdb.CleanName(folder)
+	var inFolder = pwdb.NamesInFolder(names, folder)
+	if folder != "" && len(inFolder) == 0 {
+		return fmt.Errorf("No folder named '%v'", folder)
+	}
+
+	var root = newTreeNode()
+	for _, name := range inFolder {
+		var node = root
+		for _, part := range strings.Split(strings.TrimPrefix(name, folder+pwdb.FolderSeparator), pwdb.FolderSeparator) {
+			child, ok := node.children[part]
+			if !ok {
+				child = newTreeNode()
+				node.children[part] = child
+			}
+			node = child
+		}
+		node.entry = true
+	}
+	root.print("", recursive)
+	return nil
+}
+
+func (node *treeNode) print(indent string, recursive bool) {
+	var names = make([]string, 0, len(node.children))
+	for name := range node.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var child = node.children[name]
+		if child.entry {
+			fmt.Println(indent + name)
+		}
+		if len(child.children) > 0 {
+			fmt.Println(indent + name + pwdb.FolderSeparator)
+			if recursive {
+				child.print(indent+"  ", recursive)
+			}
+		}
+	}
+}
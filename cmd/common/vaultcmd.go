@@ -0,0 +1,87 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jbester/pwdb/pkg/pwdb"
+)
+
+// Add the commands acting on the whole vault
+func RegisterVaultCommands(parent Commander, registry *Registry) {
+	var passphrase = parent.Command("passphrase", "Set or remove a passphrase")
+	registry.Register(passphrase, func(ctx *Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		password, err := GetNewPassword()
+		if err != nil {
+			return err
+		}
+		vault.ChangePassphrase(password)
+		return vault.Save()
+	})
+
+	var upgrade = parent.Command("upgrade", "Rewrite the database in the latest file format and schema")
+	registry.Register(upgrade, func(ctx *Context) error {
+		vault, err := ctx.Vault()
+		if err != nil {
+			return err
+		}
+		return DoUpgrade(vault)
+	})
+
+	var restore = parent.Command("restore", "List backups or restore one")
+	var restoreIndex = restore.Arg("backup", "Backup number").Int()
+	registry.Register(restore, func(ctx *Context) error {
+		// the database isn't opened since the current version may be unreadable
+		lock, err := LockConfig(ctx.ConfigPath)
+		if err != nil {
+			return err
+		}
+		defer lock.Unlock()
+		return DoRestore(ctx.ConfigPath, *restoreIndex)
+	})
+}
+
+// Rewrite the database in the current file format
+func DoUpgrade(vault *pwdb.Vault) error {
+	if vault.IsNew() {
+		return errors.New("No config")
+	}
+	version, schema := vault.Versions()
+	if !vault.NeedsUpgrade() {
+		fmt.Printf("Database is already at version %d schema %d\n", version, schema)
+		return nil
+	}
+	if err := vault.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Upgraded database from version %d schema %d to version %d schema %d; the old database is backup 1\n",
+		version, schema, pwdb.CurrentFileVersion, pwdb.SchemaVersion)
+	return nil
+}
+
+// list the backups or restore the chosen one
+func DoRestore(configPath string, index int) error {
+	if index == 0 {
+		backups, err := pwdb.ListBackups(configPath)
+		if err != nil {
+			return err
+		}
+		if len(backups) == 0 {
+			fmt.Println("No backups")
+		}
+		for _, backup := range backups {
+			fmt.Printf("%d\t%v\n", backup.Index, backup.ModTime.Format(TimeFormat))
+		}
+		return nil
+	}
+
+	if err := pwdb.RestoreBackup(configPath, index); err != nil {
+		return err
+	}
+	fmt.Printf("Restored backup %d; the previous database is now backup 1\n", index)
+	return nil
+}
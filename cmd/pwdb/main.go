@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os"
+
+	"github.com/jbester/pwdb/cmd/common"
+	"github.com/jbester/pwdb/cmd/common/otp"
+	"github.com/jbester/pwdb/cmd/common/pass"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func main() {
+	var app = kingpin.New("pwdb", "Password and one time password manager")
+	var registry = common.NewRegistry()
+	pass.Register(app.Command("pass", "Passwords"), registry)
+	otp.Register(app.Command("otp", "One time passwords (totp, hotp and ocra)"), registry)
+	common.RegisterVaultCommands(app.Command("vault", "The vault holding every account"), registry)
+	registry.Run(app, os.Args[1:])
+}
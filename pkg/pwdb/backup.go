@@ -0,0 +1,135 @@
+package pwdb
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Number of previous versions kept alongside the database
+var BackupCount = 5
+
+var NoBackupError = errors.New("no such backup")
+
+// A previous version of the database
+type Backup struct {
+	Index   int // 1 is the most recent
+	Path    string
+	ModTime time.Time
+}
+
+func backupPath(path string, index int) string {
+	return fmt.Sprintf("%s.bak.%d", path, index)
+}
+
+// write the contents to a temporary file in the same folder, sync it and
+// rename it over the original, backing the original up first if asked
+func writeFileAtomic(path string, data []byte, backup bool) error {
+	var folder = filepath.Dir(path)
+	fp, err := ioutil.TempFile(folder, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	var tempPath = fp.Name()
+	defer os.Remove(tempPath)
+
+	if _, err = fp.Write(data); err != nil {
+		fp.Close()
+		return err
+	}
+	if err = fp.Sync(); err != nil {
+		fp.Close()
+		return err
+	}
+	if err = fp.Close(); err != nil {
+		return err
+	}
+
+	if _, err = os.Stat(path); err == nil && backup {
+		if _, err = BackupConfig(path); err != nil {
+			return err
+		}
+	}
+	if err = os.Rename(tempPath, path); err != nil {
+		return err
+	}
+	syncFolder(folder)
+	return nil
+}
+
+// flush a rename to disk; not every platform supports syncing a folder
+func syncFolder(folder string) {
+	if fp, err := os.Open(folder); err == nil {
+		fp.Sync()
+		fp.Close()
+	}
+}
+
+// Copy the file at the given location to the first backup, shifting the
+// existing backups up and discarding the oldest.  Returns the backup location.
+func BackupConfig(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	if BackupCount < 1 {
+		return "", nil
+	}
+	if err = os.Remove(backupPath(path, BackupCount)); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	for i := BackupCount - 1; i >= 1; i-- {
+		err = os.Rename(backupPath(path, i), backupPath(path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	var first = backupPath(path, 1)
+	return first, ioutil.WriteFile(first, content, 0600)
+}
+
+// List the backups of the database at the given location, most recent first
+func ListBackups(path string) ([]Backup, error) {
+	matches, err := filepath.Glob(path + ".bak.*")
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []Backup
+	for _, match := range matches {
+		var index int
+		if _, err := fmt.Sscanf(match[len(path):], ".bak.%d", &index); err != nil {
+			continue
+		}
+		if backupPath(path, index) != match {
+			continue
+		}
+		stat, err := os.Stat(match)
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, Backup{Index: index, Path: match, ModTime: stat.ModTime()})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Index < backups[j].Index
+	})
+	return backups, nil
+}
+
+// Replace the database at the given location with one of its backups.  The
+// current version becomes the first backup.
+func RestoreBackup(path string, index int) error {
+	content, err := ioutil.ReadFile(backupPath(path, index))
+	if os.IsNotExist(err) {
+		return NoBackupError
+	} else if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, content, true)
+}
@@ -0,0 +1,65 @@
+package pwdb
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveRotatesBackups(t *testing.T) {
+	tempFolder, err := ioutil.TempDir("", "pwdb")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempFolder)
+	var tempFile = filepath.Join(tempFolder, "accounts")
+
+	var db = NewDatabase()
+	for i := 0; i < BackupCount+2; i++ {
+		db.Passwords["Something"] = PasswordEntry{Password: string(rune('a' + i))}
+		assert.NoError(t, SaveConfig(tempFile, db, nil), "Write failed")
+	}
+
+	backups, err := ListBackups(tempFile)
+	assert.NoError(t, err)
+	assert.Equal(t, BackupCount, len(backups))
+	for i, backup := range backups {
+		assert.Equal(t, i+1, backup.Index)
+		c, err := LoadConfig(backup.Path, nil)
+		assert.NoError(t, err, "Read failed")
+		assert.Equal(t, string(rune('a'+BackupCount-i)), c.Passwords["Something"].Password)
+	}
+
+	// no temporary files left behind
+	matches, err := filepath.Glob(filepath.Join(tempFolder, ".accounts.tmp*"))
+	assert.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestRestoreBackup(t *testing.T) {
+	tempFolder, err := ioutil.TempDir("", "pwdb")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempFolder)
+	var tempFile = filepath.Join(tempFolder, "accounts")
+
+	var db = NewDatabase()
+	db.Passwords["Something"] = PasswordEntry{Password: "old"}
+	assert.NoError(t, SaveConfig(tempFile, db, nil), "Write failed")
+	db.Passwords["Something"] = PasswordEntry{Password: "new"}
+	assert.NoError(t, SaveConfig(tempFile, db, nil), "Write failed")
+
+	assert.NoError(t, RestoreBackup(tempFile, 1))
+	c, err := LoadConfig(tempFile, nil)
+	assert.NoError(t, err, "Read failed")
+	assert.Equal(t, "old", c.Passwords["Something"].Password)
+
+	// the replaced version is now the first backup
+	c, err = LoadConfig(tempFile+".bak.1", nil)
+	assert.NoError(t, err, "Read failed")
+	assert.Equal(t, "new", c.Passwords["Something"].Password)
+
+	err = RestoreBackup(tempFile, 100)
+	assert.True(t, errors.Is(err, NoBackupError))
+}
@@ -1,6 +1,7 @@
 package pwdb
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
@@ -12,8 +13,10 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"runtime"
 
+	"bitbucket.org/jbester/binaryio"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
 	"golang.org/x/crypto/hkdf"
 )
 
@@ -24,38 +27,98 @@ func makeFileMarker(version uint32) []byte {
 	return []byte(fmt.Sprintf(magicMarkerFormat, version))
 }
 
-const dbVersion = 1
+// Version 1 files are either plain JSON or an HKDF keyed AES-CBC blob with no
+// marker in the clear.  Later versions always start with the marker followed
+// by the key derivation header; version 2 encrypts with AES-CBC and HMAC,
+// version 3 with XChaCha20-Poly1305.
+const legacyDbVersion = 1
+const hmacDbVersion = 2
+const dbVersion = 3
 
+var legacyMagicId = makeFileMarker(legacyDbVersion)
+var hmacMagicId = makeFileMarker(hmacDbVersion)
 var magicId = makeFileMarker(dbVersion)
 
+// The file format version written by WriteConfig
+const CurrentFileVersion = dbVersion
+
+// Reader and writer for one version of the on-disk format
+type fileFormat struct {
+	// decode the file contents returning the JSON payload
+	read func(content []byte, key []byte) ([]byte, error)
+	// encode the JSON payload; nil for versions that are only read
+	write func(payload []byte, secret []byte) ([]byte, error)
+}
+
+var fileFormats = map[uint32]fileFormat{
+	legacyDbVersion: {read: readLegacyPayload},
+	hmacDbVersion:   {read: readHmacPayload},
+	dbVersion:       {read: readAeadPayload, write: writeAeadPayload},
+}
+
 const fileIvSize = aes.BlockSize
 const aesIvSize = aes.BlockSize
 const aesKeySize = 256 / 8
 const macSize = 256 / 8
+const aeadKeySize = chacha20poly1305.KeySize
+const aeadNonceSize = chacha20poly1305.NonceSizeX
 
-// asserts to check for internal errors
-func assertTrue(condition bool, msg string) {
-	if !condition {
-		_, filename, line, _ := runtime.Caller(1)
-		fmt.Printf("Assert failed %s:%d: %s\n", filename, line, msg)
-		os.Exit(1)
-	}
-}
+// plaintext is padded to a multiple of this size to hide the number of entries
+const paddingIncrement = aes.BlockSize * 100
 
-// asserts to check for internal errors
-func assertNoError(err error, msg string) {
-	if err != nil {
-		_, filename, line, _ := runtime.Caller(1)
-		fmt.Printf("Assert failed %s:%d %s\nerror: %s\n", filename, line, msg, err.Error())
-		os.Exit(1)
-	}
+// Key derivation functions recorded in the file header
+const (
+	kdfNone     uint8 = 0
+	kdfArgon2id uint8 = 1
+)
+
+const kdfSaltSize = 16
+const kdfHeaderSize = 1 + 4 + 4 + 1 + kdfSaltSize
+
+// upper bounds on the argon2 costs accepted from a file; the header isn't
+// authenticated until the key is derived so a tampered file mustn't be able
+// to make opening it hang or exhaust memory
+const (
+	maxArgon2Time   = 100
+	maxArgon2Memory = 1024 * 1024 // KiB
+)
+
+// Key derivation parameters stored in the clear after the magic marker
+type kdfHeader struct {
+	Kdf     uint8
+	Time    uint32
+	Memory  uint32 // KiB
+	Threads uint8
+	Salt    [kdfSaltSize]byte
 }
 
+// Argon2id cost used when writing new files
+var defaultKdfHeader = kdfHeader{Kdf: kdfArgon2id, Time: 3, Memory: 64 * 1024, Threads: 4}
+
 var DatabaseEncryptedError = errors.New("database encrypted error")
 var IncorrectKeyError = errors.New("incorrect key")
+var TruncatedFileError = errors.New("truncated file")
+var UnsupportedVersionError = errors.New("unsupported file version")
+var InvalidKdfParametersError = errors.New("invalid key derivation parameters")
+var InvalidPaddingError = errors.New("invalid padding")
+var InvalidJSONError = errors.New("invalid database contents")
+var CorruptDatabaseError = errors.New("corrupt database")
+var RandomSourceError = errors.New("could not generate secure random")
+var ReadError = errors.New("could not read config file")
+
+// fill the buffer from the secure random source
+func randomBytes(b []byte) error {
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return fmt.Errorf("%w: %v", RandomSourceError, err)
+	}
+	return nil
+}
 
 func getDbVersion(b []byte) (uint32, error) {
 	var dbVersionValue uint32
+	if len(b) < magicMarkerLength {
+		return 0, TruncatedFileError
+	}
 	_, err := fmt.Sscanf(string(b[:magicMarkerLength]), magicMarkerFormat, &dbVersionValue)
 	if err != nil {
 		return 0, err
@@ -71,92 +134,285 @@ func isValidMagicId(b []byte) bool {
 	return ver != 0
 }
 
+// get the format version of file contents; legacy encrypted files have no marker
+func getFileVersion(b []byte) uint32 {
+	if !isValidMagicId(b) {
+		return legacyDbVersion
+	}
+	var version, _ = getDbVersion(b)
+	return version
+}
+
+// Get the format version of the file at the given location
+func GetFileVersion(path string) (uint32, error) {
+	var fp, err = os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer fp.Close()
+
+	var b = make([]byte, magicMarkerLength)
+	if _, err = io.ReadFull(fp, b); err != nil {
+		return 0, err
+	}
+	return getFileVersion(b), nil
+}
+
+func encodeKdfHeader(hdr kdfHeader) ([]byte, error) {
+	var writer = binaryio.BigEndianBufferWriter()
+	if err := writer.Write(hdr); err != nil {
+		return nil, err
+	}
+	return writer.Bytes(), nil
+}
+
+func decodeKdfHeader(b []byte) (kdfHeader, error) {
+	var hdr kdfHeader
+	if len(b) < kdfHeaderSize {
+		return hdr, TruncatedFileError
+	}
+	var reader = binaryio.BigEndianBufferReader(b[:kdfHeaderSize])
+	if err := reader.Read(&hdr); err != nil {
+		return hdr, TruncatedFileError
+	}
+	return hdr, nil
+}
+
+// derive a key of the given size from the passphrase
+func (hdr kdfHeader) deriveKey(secret []byte, size uint32) ([]byte, error) {
+	if hdr.Kdf != kdfArgon2id {
+		return nil, InvalidKdfParametersError
+	}
+	if hdr.Time == 0 || hdr.Time > maxArgon2Time || hdr.Threads == 0 ||
+		hdr.Memory < 8*uint32(hdr.Threads) || hdr.Memory > maxArgon2Memory {
+		return nil, InvalidKdfParametersError
+	}
+	return argon2.IDKey(secret, hdr.Salt[:], hdr.Time, hdr.Memory, hdr.Threads, size), nil
+}
+
 // Test if a file is encrypted
 func IsEncrypted(path string) bool {
 	var fp, err = os.Open(path)
-	var b = make([]byte, len(magicId))
+	if err != nil {
+		return false
+	}
 	defer fp.Close()
 
-	if err != nil {
+	var b = make([]byte, len(magicId)+kdfHeaderSize)
+
+	n, err := io.ReadFull(fp, b)
+	if n < len(magicId) {
 		return false
 	}
 
-	if _, err = fp.Read(b); err != nil {
+	// legacy encrypted files have no marker
+	version, err := getDbVersion(b)
+	if err != nil || version == 0 {
+		return true
+	}
+	if version == legacyDbVersion {
 		return false
 	}
 
-	// test if encrypted
-	return !isValidMagicId(b)
+	hdr, err := decodeKdfHeader(b[len(magicId):n])
+	if err != nil {
+		return false
+	}
+	return hdr.Kdf != kdfNone
 }
 
 var InvalidHMACError = errors.New("invalid HMAC")
 
 // Read a config from the given Reader
 func ReadConfig(reader io.Reader, key []byte) (*Database, error) {
-	var db Database
 	content, err := ioutil.ReadAll(reader)
-	assertNoError(err, "could not read config file")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ReadError, err)
+	}
+	db, _, err := readConfig(content, key)
+	return db, err
+}
 
-	// test if encrypted
-	if !isValidMagicId(content) {
-		if key == nil {
-			return nil, DatabaseEncryptedError
-		}
-		// validate HMAC
-		if !isHMACValid(key, content) {
-			return nil, InvalidHMACError
-		}
-		// attempt decryption
-		var candidate = decrypt(key, content[:len(content)-macSize])
-		// test if it's a valid config
-		assertTrue(isValidMagicId(candidate), "internal error - valid HMAC invalid contents")
-		content = candidate
-	}
-
-	// strip off the magic id
-	content = content[len(magicId):]
-	for i, b := range content {
-		if b == 0 {
-			content = content[:i]
-			break
-		}
+// read a config also returning the schema version it was written with
+func readConfig(content []byte, key []byte) (*Database, uint32, error) {
+	var db Database
+	if len(content) == 0 {
+		return nil, 0, TruncatedFileError
 	}
+
+	format, ok := fileFormats[getFileVersion(content)]
+	if !ok {
+		return nil, 0, UnsupportedVersionError
+	}
+	content, err := format.read(content, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	content, schemaVersion, err := migrate(content)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	// un-marshall account data
 	if err = json.Unmarshal(content, &db); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", InvalidJSONError, err)
+	}
+
+	return &db, schemaVersion, nil
+}
+
+// strip the zero terminator and any padding that follows it
+func trimPadding(content []byte) []byte {
+	if i := bytes.IndexByte(content, 0); i >= 0 {
+		return content[:i]
+	}
+	return content
+}
+
+// strip the padding from decrypted content which must be zero terminated
+func unpad(content []byte) ([]byte, error) {
+	if bytes.IndexByte(content, 0) < 0 {
+		return nil, InvalidPaddingError
+	}
+	return trimPadding(content), nil
+}
+
+// read a version 1 file returning the JSON payload
+func readLegacyPayload(content []byte, key []byte) ([]byte, error) {
+	if isValidMagicId(content) {
+		return trimPadding(content[len(legacyMagicId):]), nil
+	}
+	return readLegacyEncrypted(content, key)
+}
+
+// decrypt a version 1 file returning the JSON payload
+func readLegacyEncrypted(content []byte, key []byte) ([]byte, error) {
+	if key == nil {
+		return nil, DatabaseEncryptedError
+	}
+	if len(content) < fileIvSize+aes.BlockSize+macSize || (len(content)-macSize)%aes.BlockSize != 0 {
+		return nil, TruncatedFileError
+	}
+	legacyKey, err := kdf(key, content[:fileIvSize])
+	if err != nil {
+		return nil, err
+	}
+	// validate HMAC
+	if !isHMACValid(legacyKey, content) {
+		return nil, InvalidHMACError
+	}
+	// attempt decryption
+	candidate, err := decrypt(legacyKey, content[:len(content)-macSize])
+	if err != nil {
+		return nil, err
+	}
+	// test if it's a valid config
+	if !isValidMagicId(candidate) {
+		return nil, CorruptDatabaseError
+	}
+	return unpad(candidate[len(legacyMagicId):])
+}
+
+// verify and decrypt a version 2 file returning the JSON payload
+func readHmacPayload(content []byte, key []byte) ([]byte, error) {
+	var headerLength = len(hmacMagicId) + kdfHeaderSize
+	hdr, err := decodeKdfHeader(content[len(hmacMagicId):])
+	if err != nil {
+		return nil, err
+	}
+	var body = content[headerLength:]
+	if hdr.Kdf == kdfNone {
+		return body, nil
+	}
+
+	if key == nil {
+		return nil, DatabaseEncryptedError
+	}
+	if len(body) < fileIvSize+macSize || (len(body)-fileIvSize-macSize)%aes.BlockSize != 0 {
+		return nil, TruncatedFileError
+	}
+	keys, err := hdr.deriveKey(key, aesKeySize+macSize)
+	if err != nil {
 		return nil, err
 	}
+	var encKey, macKey = keys[:aesKeySize], keys[aesKeySize:]
 
-	return &db, nil
+	// the MAC covers the header as well as the ciphertext
+	var authenticated = content[:len(content)-macSize]
+	if !hmac.Equal(computeHMAC(macKey, authenticated), content[len(content)-macSize:]) {
+		return nil, InvalidHMACError
+	}
+	plaintext, err := decrypt(encKey, body[:len(body)-macSize])
+	if err != nil {
+		return nil, err
+	}
+	return unpad(plaintext)
+}
+
+// open a version 3 file returning the JSON payload
+func readAeadPayload(content []byte, key []byte) ([]byte, error) {
+	var headerLength = len(magicId) + kdfHeaderSize
+	hdr, err := decodeKdfHeader(content[len(magicId):])
+	if err != nil {
+		return nil, err
+	}
+	var body = content[headerLength:]
+	if hdr.Kdf == kdfNone {
+		return body, nil
+	}
+
+	if key == nil {
+		return nil, DatabaseEncryptedError
+	}
+	aeadKey, err := hdr.deriveKey(key, aeadKeySize)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(aeadKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < aeadNonceSize+aead.Overhead() {
+		return nil, TruncatedFileError
+	}
+
+	// the header is bound in as associated data
+	plaintext, err := aead.Open(nil, body[:aeadNonceSize], body[aeadNonceSize:], content[:headerLength])
+	if err != nil {
+		return nil, InvalidHMACError
+	}
+	return unpad(plaintext)
 }
 
 func LoadConfig(path string, key []byte) (*Database, error) {
 	var fp, err = os.Open(path)
-	defer fp.Close()
 	if err != nil {
 		return nil, err
 	}
+	defer fp.Close()
 	return ReadConfig(fp, key)
 }
 
-// generate a key using HKDF
-func kdf(secret []byte, iv []byte) []byte {
+// generate a version 1 key using HKDF
+func kdf(secret []byte, iv []byte) ([]byte, error) {
 	var key = make([]byte, aesKeySize)
-	kdf := hkdf.New(sha256.New, secret, iv, magicId[:])
-	n, err := kdf.Read(key)
-	assertTrue(n == aesKeySize, "key generation error")
-	assertNoError(err, "key generation error")
-	return key
+	kdf := hkdf.New(sha256.New, secret, iv, legacyMagicId[:])
+	if _, err := io.ReadFull(kdf, key); err != nil {
+		return nil, fmt.Errorf("key generation error: %w", err)
+	}
+	return key, nil
 }
 
-// encrypt
-func encrypt(password []byte, iv []byte, plaintext []byte) []byte {
-	const minimumIncrement = aes.BlockSize * 100
+// encrypt returns the iv followed by the padded ciphertext
+func encrypt(key []byte, iv []byte, plaintext []byte) ([]byte, error) {
+	const minimumIncrement = paddingIncrement
 	if len(iv) != aesIvSize {
-		panic("Internal error; iv isn't expected iv size")
+		return nil, fmt.Errorf("invalid iv size %d", len(iv))
 	}
-	key := kdf(password, iv)
 	block, err := aes.NewCipher(key)
-	assertNoError(err, "aes new cipher failed")
+	if err != nil {
+		return nil, err
+	}
 
 	var encryptor = cipher.NewCBCEncrypter(block, iv[:aesIvSize])
 	var prepaddingSize = len(plaintext)
@@ -165,9 +421,9 @@ func encrypt(password []byte, iv []byte, plaintext []byte) []byte {
 	if prepaddingSize%minimumIncrement != 0 {
 		var paddingSize = minimumIncrement - (prepaddingSize % minimumIncrement)
 		var padding = make([]byte, paddingSize)
-		n, err := rand.Read(padding[:])
-		assertNoError(err, "could not generate new random numbers")
-		assertTrue(n == paddingSize, "could not generate new random numbers")
+		if err := randomBytes(padding); err != nil {
+			return nil, err
+		}
 		plaintext = append(plaintext, padding[:]...)
 	}
 
@@ -176,57 +432,62 @@ func encrypt(password []byte, iv []byte, plaintext []byte) []byte {
 	encryptor.CryptBlocks(encrypted[fileIvSize:], plaintext)
 	copy(encrypted[:fileIvSize], iv)
 
-	// append hmac after encryption
-	mac := hmac.New(sha256.New, key)
-	mac.Write(encrypted)
-	encrypted = append(encrypted, mac.Sum(nil)...)
+	return encrypted, nil
+}
 
-	return encrypted
+func computeHMAC(key []byte, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return mac.Sum(nil)
 }
 
-func isHMACValid(password []byte, content []byte) bool {
-	var iv = content[:fileIvSize]
-	key := kdf(password, iv)
+// validate the HMAC of a version 1 file
+func isHMACValid(key []byte, content []byte) bool {
 	expected := content[len(content)-macSize:]
 	payload := content[:len(content)-macSize]
 
 	// mac just the content
-	mac := hmac.New(sha256.New, key)
-	mac.Write(payload)
-	var m = mac.Sum(nil)
-
-	var ok = true
-	for i := 0; i < macSize; i++ {
-		ok = expected[i] == m[i] && ok
-	}
-	return ok
+	return hmac.Equal(expected, computeHMAC(key, payload))
 }
 
 // Decrypt assumes any MAC is already removed
-func decrypt(password []byte, content []byte) []byte {
+func decrypt(key []byte, content []byte) ([]byte, error) {
+	if len(content) < fileIvSize || (len(content)-fileIvSize)%aes.BlockSize != 0 {
+		return nil, TruncatedFileError
+	}
 	var iv = content[:fileIvSize]
 	payload := content[fileIvSize:]
 
-	key := kdf(password, iv)
 	block, err := aes.NewCipher(key)
-
-	assertNoError(err, "aes new cipher failed")
+	if err != nil {
+		return nil, err
+	}
 	var decrypter = cipher.NewCBCDecrypter(block, iv[:aesIvSize])
 	var decrypted = make([]byte, len(payload))
 	decrypter.CryptBlocks(decrypted, payload)
-	return decrypted
+	return decrypted, nil
 }
 
-// Save a config to a given file location.   It will be created with 600 permissions
+// Save a config to a given file location.   It will be created with 600 permissions.
+// The new contents are written to a temporary file and renamed over the
+// original once complete so an interrupted save leaves the previous version
+// intact; the previous version is kept as the first backup.
 func SaveConfig(path string, db *Database, secret []byte) error {
-	var permissions os.FileMode = 0600
+	return saveConfig(path, db, secret, true)
+}
 
-	fp, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, permissions)
-	if err != nil {
+// Save a config like SaveConfig without backing up the previous version; for
+// changes such as access times that shouldn't push real backups out
+func SaveConfigInPlace(path string, db *Database, secret []byte) error {
+	return saveConfig(path, db, secret, false)
+}
+
+func saveConfig(path string, db *Database, secret []byte, backup bool) error {
+	var buf bytes.Buffer
+	if err := WriteConfig(&buf, db, secret); err != nil {
 		return err
 	}
-
-	return WriteConfig(fp, db, secret)
+	return writeFileAtomic(path, buf.Bytes(), backup)
 }
 
 // Write a config to the given io.writer
@@ -235,19 +496,54 @@ func WriteConfig(writer io.Writer, db *Database, secret []byte) error {
 		return fmt.Errorf("invalid database")
 	}
 
-	data, err := json.Marshal(*db)
-	assertNoError(err, "unmarshallable database")
+	var current = *db
+	current.Version = SchemaVersion
+	data, err := json.Marshal(current)
+	if err != nil {
+		return fmt.Errorf("%w: %v", InvalidJSONError, err)
+	}
 
-	data = append(magicId, data...)
-	data = append(data, 0)
-	if secret != nil {
-		// NB - IV is used for KDF as well so it's a full AES Block
-		var iv = make([]byte, aesIvSize)
-		n, err := rand.Read(iv)
-		assertTrue(n == aesIvSize, "could not generate secure random")
-		assertNoError(err, "could not generate secure random")
-		data = encrypt(secret, iv[:aesIvSize], data)
+	data, err = fileFormats[CurrentFileVersion].write(data, secret)
+	if err != nil {
+		return err
 	}
 	_, err = writer.Write(data)
 	return err
 }
+
+// encode a JSON payload as a version 3 file
+func writeAeadPayload(data []byte, secret []byte) ([]byte, error) {
+	var hdr kdfHeader
+	if secret != nil {
+		hdr = defaultKdfHeader
+		if err := randomBytes(hdr.Salt[:]); err != nil {
+			return nil, err
+		}
+	}
+	encodedHeader, err := encodeKdfHeader(hdr)
+	if err != nil {
+		return nil, err
+	}
+	var header = append(append([]byte{}, magicId...), encodedHeader...)
+	if secret == nil {
+		return append(header, data...), nil
+	}
+
+	aeadKey, err := hdr.deriveKey(secret, aeadKeySize)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(aeadKey)
+	if err != nil {
+		return nil, err
+	}
+	var nonce = make([]byte, aeadNonceSize)
+	if err = randomBytes(nonce); err != nil {
+		return nil, err
+	}
+
+	// zero terminate and pad to hide the size of the database
+	var paddingSize = paddingIncrement - (len(data) % paddingIncrement)
+	data = append(data, make([]byte, paddingSize)...)
+	return aead.Seal(append(header, nonce...), nonce, data, header), nil
+}
@@ -2,6 +2,9 @@ package pwdb
 
 import (
 	"bytes"
+	crand "crypto/rand"
+	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -160,3 +163,148 @@ func TestLoadEncryptedDbWithoutPassword(t *testing.T) {
 	assert.True(t, errors.Is(err, DatabaseEncryptedError), "Read failed")
 	os.Remove(tempFile)
 }
+
+// write a database in the version 1 format
+func writeLegacyConfig(t *testing.T, db *Database, secret []byte) []byte {
+	data, err := json.Marshal(*db)
+	assert.NoError(t, err)
+	data = append(append([]byte{}, legacyMagicId...), data...)
+	data = append(data, 0)
+	if secret == nil {
+		return data
+	}
+	var iv = make([]byte, aesIvSize)
+	_, err = crand.Read(iv)
+	assert.NoError(t, err)
+	key, err := kdf(secret, iv)
+	assert.NoError(t, err)
+	data, err = encrypt(key, iv, data)
+	assert.NoError(t, err)
+	return append(data, computeHMAC(key, data)...)
+}
+
+func TestLoadLegacyDb(t *testing.T) {
+	var db = NewDatabase()
+	var secret = []byte("some secret password")
+	db.TotpAccounts["Something"] = TotpEntry{Secret: "some secret"}
+	db.Passwords["Something else"] = PasswordEntry{
+		Username: "loginame@example.com",
+		Password: "some secret"}
+
+	// unencrypted
+	c, err := ReadConfig(bytes.NewReader(writeLegacyConfig(t, db, nil)), nil)
+	assert.NoError(t, err, "Read failed")
+	assert.True(t, reflect.DeepEqual(*c, *db), "Database don't match")
+
+	// encrypted
+	var encrypted = writeLegacyConfig(t, db, secret)
+	_, err = ReadConfig(bytes.NewReader(encrypted), nil)
+	assert.True(t, errors.Is(err, DatabaseEncryptedError), "Read succeeded")
+	c, err = ReadConfig(bytes.NewReader(encrypted), secret)
+	assert.NoError(t, err, "Read failed")
+	assert.True(t, reflect.DeepEqual(*c, *db), "Database don't match")
+}
+
+func TestLoadSaveTamperedKdfHeader(t *testing.T) {
+	var db = NewDatabase()
+	var buf = &bytes.Buffer{}
+	var secret = []byte("some secret")
+	err := WriteConfig(buf, db, secret)
+	assert.NoError(t, err, "Write failed")
+
+	// lower the argon2 time cost
+	var encrypted = buf.Bytes()
+	encrypted[len(magicId)+4] = 1
+	_, err = ReadConfig(bytes.NewReader(encrypted), secret)
+	assert.True(t, errors.Is(err, InvalidHMACError), "Read succeeded")
+
+	// costs too high to derive a key with
+	for _, offset := range []int{len(magicId) + 1, len(magicId) + 5} {
+		var tampered = append([]byte{}, buf.Bytes()...)
+		binary.BigEndian.PutUint32(tampered[offset:], 0xffffffff)
+		_, err = ReadConfig(bytes.NewReader(tampered), secret)
+		assert.True(t, errors.Is(err, InvalidKdfParametersError), "Read succeeded")
+	}
+}
+
+// write an encrypted database in the version 2 format
+func writeHmacConfig(t *testing.T, db *Database, secret []byte) []byte {
+	data, err := json.Marshal(*db)
+	assert.NoError(t, err)
+	data = append(data, 0)
+	var hdr = defaultKdfHeader
+	_, err = crand.Read(hdr.Salt[:])
+	assert.NoError(t, err)
+	keys, err := hdr.deriveKey(secret, aesKeySize+macSize)
+	assert.NoError(t, err)
+	var iv = make([]byte, aesIvSize)
+	_, err = crand.Read(iv)
+	assert.NoError(t, err)
+	encodedHeader, err := encodeKdfHeader(hdr)
+	assert.NoError(t, err)
+	encrypted, err := encrypt(keys[:aesKeySize], iv, data)
+	assert.NoError(t, err)
+	data = append(append(append([]byte{}, hmacMagicId...), encodedHeader...), encrypted...)
+	return append(data, computeHMAC(keys[aesKeySize:], data)...)
+}
+
+func TestLoadHmacDb(t *testing.T) {
+	var db = NewDatabase()
+	var secret = []byte("some secret password")
+	db.Passwords["Something else"] = PasswordEntry{
+		Username: "loginame@example.com",
+		Password: "some secret"}
+
+	var encrypted = writeHmacConfig(t, db, secret)
+	c, err := ReadConfig(bytes.NewReader(encrypted), secret)
+	assert.NoError(t, err, "Read failed")
+	assert.True(t, reflect.DeepEqual(*c, *db), "Database don't match")
+
+	_, err = ReadConfig(bytes.NewReader(encrypted), []byte("some other secret password"))
+	assert.True(t, errors.Is(err, InvalidHMACError), "Read succeeded")
+}
+
+func TestLoadUnsupportedVersion(t *testing.T) {
+	var content = append(makeFileMarker(dbVersion+1), '{', '}')
+	_, err := ReadConfig(bytes.NewReader(content), nil)
+	assert.True(t, errors.Is(err, UnsupportedVersionError), "Read succeeded")
+}
+
+func TestLoadTruncatedDb(t *testing.T) {
+	var db = NewDatabase()
+	var secret = []byte("some secret password")
+	var buf = &bytes.Buffer{}
+	err := WriteConfig(buf, db, secret)
+	assert.NoError(t, err, "Write failed")
+	var content = buf.Bytes()
+
+	for _, length := range []int{0, 5, len(magicId) + 3, len(magicId) + kdfHeaderSize + 10} {
+		_, err = ReadConfig(bytes.NewReader(content[:length]), secret)
+		assert.True(t, errors.Is(err, TruncatedFileError), "Read succeeded at length %d", length)
+	}
+
+	// too short to be a legacy encrypted file
+	_, err = ReadConfig(bytes.NewReader([]byte("garbage")), secret)
+	assert.True(t, errors.Is(err, TruncatedFileError), "Read succeeded")
+}
+
+func TestLoadInvalidJSON(t *testing.T) {
+	var content = append(append([]byte{}, legacyMagicId...), []byte("{not json")...)
+	_, err := ReadConfig(bytes.NewReader(content), nil)
+	assert.True(t, errors.Is(err, InvalidJSONError), "Read succeeded")
+}
+
+func TestLoadMissingPadding(t *testing.T) {
+	var secret = []byte("some secret password")
+	var iv = make([]byte, aesIvSize)
+	key, err := kdf(secret, iv)
+	assert.NoError(t, err)
+	// marker and JSON padded with spaces instead of a terminator
+	var data = append(append([]byte{}, legacyMagicId...), []byte(`{}`)...)
+	data, err = encrypt(key, iv, append(data, bytes.Repeat([]byte{' '}, paddingIncrement-len(data))...))
+	assert.NoError(t, err)
+	data = append(data, computeHMAC(key, data)...)
+
+	_, err = ReadConfig(bytes.NewReader(data), secret)
+	assert.True(t, errors.Is(err, InvalidPaddingError), "Read succeeded")
+}
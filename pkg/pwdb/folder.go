@@ -0,0 +1,115 @@
+package pwdb
+
+import (
+	"sort"
+	"strings"
+)
+
+// Account names are slash separated paths e.g. work/aws/prod-root; every
+// part but the last names a folder
+const FolderSeparator = "/"
+
+// Remove empty path parts from a name e.g. /work//aws/ is work/aws
+func CleanName(name string) string {
+	var parts []string
+	for _, part := range strings.Split(name, FolderSeparator) {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, FolderSeparator)
+}
+
+// The sorted names in a folder and its subfolders; every name for the empty
+// folder
+func NamesInFolder(names []string, folder string) []string {
+	folder = CleanName(folder)
+	var result []string
+	for _, name := range names {
+		if folder == "" || strings.HasPrefix(name, folder+FolderSeparator) {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// the names a folder move renames, checking none of the new names are taken
+func folderMoves(names []string, from string, to string) (map[string]string, error) {
+	from, to = CleanName(from), CleanName(to)
+	var inFolder = NamesInFolder(names, from)
+	if from == "" || len(inFolder) == 0 {
+		return nil, NoEntryError
+	}
+	var taken = make(map[string]bool, len(names))
+	for _, name := range names {
+		taken[name] = true
+	}
+	var moves = make(map[string]string, len(inFolder))
+	for _, name := range inFolder {
+		var moved = CleanName(to + FolderSeparator + strings.TrimPrefix(name, from+FolderSeparator))
+		if taken[moved] && !strings.HasPrefix(moved, from+FolderSeparator) {
+			return nil, EntryExistsError
+		}
+		moves[name] = moved
+	}
+	return moves, nil
+}
+
+// Move every password entry in a folder to another
+func (vault *Vault) MovePasswordFolder(from string, to string) error {
+	moves, err := folderMoves(vault.ListPasswords(), from, to)
+	if err != nil {
+		return err
+	}
+	var moved = make(map[string]PasswordEntry, len(moves))
+	for name, newName := range moves {
+		moved[newName] = vault.db.Passwords[name]
+		delete(vault.db.Passwords, name)
+	}
+	for name, entry := range moved {
+		vault.db.Passwords[name] = entry
+	}
+	return nil
+}
+
+// Remove every password entry in a folder returning how many were removed
+func (vault *Vault) DeletePasswordFolder(folder string) int {
+	if CleanName(folder) == "" {
+		return 0
+	}
+	var names = NamesInFolder(vault.ListPasswords(), folder)
+	for _, name := range names {
+		delete(vault.db.Passwords, name)
+	}
+	return len(names)
+}
+
+// Move every totp entry in a folder to another
+func (vault *Vault) MoveTotpFolder(from string, to string) error {
+	moves, err := folderMoves(vault.ListTotp(), from, to)
+	if err != nil {
+		return err
+	}
+	var moved = make(map[string]TotpEntry, len(moves))
+	for name, newName := range moves {
+		moved[newName] = vault.db.TotpAccounts[name]
+		delete(vault.db.TotpAccounts, name)
+	}
+	for name, entry := range moved {
+		vault.db.TotpAccounts[name] = entry
+	}
+	return nil
+}
+
+// Remove every totp entry in a folder returning how many were removed
+func (vault *Vault) DeleteTotpFolder(folder string) int {
+	if CleanName(folder) == "" {
+		return 0
+	}
+	var names = NamesInFolder(vault.ListTotp(), folder)
+	for _, name := range names {
+		delete(vault.db.TotpAccounts, name)
+	}
+	return len(names)
+}
@@ -0,0 +1,59 @@
+package pwdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanName(t *testing.T) {
+	assert.Equal(t, "work/aws", CleanName("/work//aws/"))
+	assert.Equal(t, "work/aws", CleanName("work / aws"))
+	assert.Equal(t, "", CleanName("/"))
+}
+
+func TestNamesInFolder(t *testing.T) {
+	var names = []string{"workshop", "work/b", "work/a/x", "home"}
+	assert.Equal(t, []string{"work/a/x", "work/b"}, NamesInFolder(names, "work/"))
+	assert.Equal(t, []string{"work/a/x"}, NamesInFolder(names, "work/a"))
+	assert.Equal(t, []string{"home", "work/a/x", "work/b", "workshop"}, NamesInFolder(names, ""))
+	assert.Empty(t, NamesInFolder(names, "wor"))
+}
+
+func TestVaultFolders(t *testing.T) {
+	tempFolder, err := ioutil.TempDir("", "pwdb")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempFolder)
+
+	vault, err := Open(filepath.Join(tempFolder, "accounts"), nil)
+	assert.NoError(t, err)
+	defer vault.Close()
+	for _, name := range []string{"work/aws/prod", "work/aws/dev", "work/github", "home/mail"} {
+		vault.PutPassword(name, PasswordEntry{Password: name})
+	}
+
+	vault.PutPassword("cloud/dev", PasswordEntry{})
+	assert.Equal(t, EntryExistsError, vault.MovePasswordFolder("work/aws", "cloud"))
+	vault.DeletePassword("cloud/dev")
+	assert.Equal(t, NoEntryError, vault.MovePasswordFolder("nothing", "else"))
+	assert.NoError(t, vault.MovePasswordFolder("work/aws", "cloud"))
+	assert.Equal(t, []string{"cloud/dev", "cloud/prod", "home/mail", "work/github"}, vault.ListPasswords())
+	entry, _ := vault.GetPassword("cloud/prod")
+	assert.Equal(t, "work/aws/prod", entry.Password)
+
+	// moving into a subfolder of itself
+	assert.NoError(t, vault.MovePasswordFolder("cloud", "cloud/aws"))
+	assert.Equal(t, []string{"cloud/aws/dev", "cloud/aws/prod", "home/mail", "work/github"}, vault.ListPasswords())
+
+	assert.Equal(t, 2, vault.DeletePasswordFolder("cloud"))
+	assert.Equal(t, 0, vault.DeletePasswordFolder(""))
+	assert.Equal(t, []string{"home/mail", "work/github"}, vault.ListPasswords())
+
+	vault.PutTotp("work/github", TotpEntry{})
+	assert.NoError(t, vault.MoveTotpFolder("work", "old"))
+	assert.Equal(t, []string{"old/github"}, vault.ListTotp())
+	assert.Equal(t, 1, vault.DeleteTotpFolder("old"))
+}
@@ -0,0 +1,131 @@
+package pwdb
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+var LockedError = errors.New("database is locked by another process")
+var ConcurrentModificationError = errors.New("database changed since it was read")
+
+// how often a blocked lock is retried
+const lockRetryInterval = 100 * time.Millisecond
+
+// An exclusive advisory lock on a database file held across
+// load-modify-save.  Saves through the lock refuse to overwrite the file if
+// its contents changed since it was loaded.
+type Lock struct {
+	path     string
+	fp       *os.File
+	loaded   bool
+	contents [sha256.Size]byte
+	exists   bool
+	version  uint32 // file format version of the loaded file
+	schema   uint32 // schema version of the loaded file before migration
+}
+
+// Lock the database at the given location waiting up to timeout for another
+// process to release it.  The lock is taken on a separate file alongside the
+// database since saves replace the database file.
+func LockConfig(path string, timeout time.Duration) (*Lock, error) {
+	fp, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	var deadline = time.Now().Add(timeout)
+	for {
+		err = tryLockFile(fp)
+		if err == nil {
+			return &Lock{path: path, fp: fp}, nil
+		}
+		if !errors.Is(err, LockedError) || !time.Now().Before(deadline) {
+			fp.Close()
+			return nil, err
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// Release the lock
+func (lock *Lock) Unlock() error {
+	if lock.fp == nil {
+		return nil
+	}
+	var err = unlockFile(lock.fp)
+	if closeErr := lock.fp.Close(); err == nil {
+		err = closeErr
+	}
+	lock.fp = nil
+	return err
+}
+
+// snapshot the current contents of the database file
+func (lock *Lock) fingerprint() (bool, [sha256.Size]byte, error) {
+	content, err := ioutil.ReadFile(lock.path)
+	if os.IsNotExist(err) {
+		return false, [sha256.Size]byte{}, nil
+	} else if err != nil {
+		return false, [sha256.Size]byte{}, err
+	}
+	return true, sha256.Sum256(content), nil
+}
+
+// Load the database recording its contents for change detection.  Returns a
+// new database if the file doesn't exist.
+func (lock *Lock) Load(key []byte) (*Database, error) {
+	content, err := ioutil.ReadFile(lock.path)
+	if os.IsNotExist(err) {
+		lock.loaded, lock.exists = true, false
+		return NewDatabase(), nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	db, schema, err := readConfig(content, key)
+	if err != nil {
+		return nil, err
+	}
+	lock.loaded, lock.exists, lock.contents = true, true, sha256.Sum256(content)
+	lock.version, lock.schema = getFileVersion(content), schema
+	return db, nil
+}
+
+// Save the database provided the file is unchanged since it was loaded
+func (lock *Lock) Save(db *Database, secret []byte) error {
+	return lock.save(db, secret, true)
+}
+
+// Save the database like Save without backing up the previous version
+func (lock *Lock) SaveInPlace(db *Database, secret []byte) error {
+	return lock.save(db, secret, false)
+}
+
+func (lock *Lock) save(db *Database, secret []byte, backup bool) error {
+	if lock.fp == nil {
+		return errors.New("database is not locked")
+	}
+	if lock.loaded {
+		exists, contents, err := lock.fingerprint()
+		if err != nil {
+			return err
+		}
+		if exists != lock.exists || contents != lock.contents {
+			return ConcurrentModificationError
+		}
+	}
+
+	if err := saveConfig(lock.path, db, secret, backup); err != nil {
+		return err
+	}
+	exists, contents, err := lock.fingerprint()
+	if err != nil {
+		return err
+	}
+	lock.loaded, lock.exists, lock.contents = true, exists, contents
+	lock.version, lock.schema = CurrentFileVersion, SchemaVersion
+	return nil
+}
@@ -0,0 +1,58 @@
+package pwdb
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockExclusive(t *testing.T) {
+	tempFolder, err := ioutil.TempDir("", "pwdb")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempFolder)
+	var tempFile = filepath.Join(tempFolder, "accounts")
+
+	lock, err := LockConfig(tempFile, 0)
+	assert.NoError(t, err)
+
+	_, err = LockConfig(tempFile, 0)
+	assert.True(t, errors.Is(err, LockedError), "Lock succeeded")
+
+	assert.NoError(t, lock.Unlock())
+	lock, err = LockConfig(tempFile, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, lock.Unlock())
+}
+
+func TestLockDetectsModification(t *testing.T) {
+	tempFolder, err := ioutil.TempDir("", "pwdb")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempFolder)
+	var tempFile = filepath.Join(tempFolder, "accounts")
+
+	lock, err := LockConfig(tempFile, 0)
+	assert.NoError(t, err)
+	defer lock.Unlock()
+
+	db, err := lock.Load(nil)
+	assert.NoError(t, err)
+	db.Passwords["Something"] = PasswordEntry{Password: "some secret"}
+	assert.NoError(t, lock.Save(db, nil))
+
+	// saving again through the lock is fine
+	assert.NoError(t, lock.Save(db, nil))
+
+	// a writer ignoring the lock changes the file
+	var other = NewDatabase()
+	assert.NoError(t, SaveConfig(tempFile, other, nil))
+	err = lock.Save(db, nil)
+	assert.True(t, errors.Is(err, ConcurrentModificationError), "Save succeeded")
+
+	c, err := LoadConfig(tempFile, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, c.Passwords)
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+// +build !windows
+
+package pwdb
+
+import (
+	"os"
+	"syscall"
+)
+
+func tryLockFile(fp *os.File) error {
+	var err = syscall.Flock(int(fp.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return LockedError
+	}
+	return err
+}
+
+func unlockFile(fp *os.File) error {
+	return syscall.Flock(int(fp.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,25 @@
+//go:build windows
+// +build windows
+
+package pwdb
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+func tryLockFile(fp *os.File) error {
+	var overlapped windows.Overlapped
+	var flags uint32 = windows.LOCKFILE_EXCLUSIVE_LOCK | windows.LOCKFILE_FAIL_IMMEDIATELY
+	var err = windows.LockFileEx(windows.Handle(fp.Fd()), flags, 0, 1, 0, &overlapped)
+	if err == windows.ERROR_LOCK_VIOLATION {
+		return LockedError
+	}
+	return err
+}
+
+func unlockFile(fp *os.File) error {
+	var overlapped windows.Overlapped
+	return windows.UnlockFileEx(windows.Handle(fp.Fd()), 0, 1, 0, &overlapped)
+}
@@ -0,0 +1,107 @@
+package pwdb
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// The version of the JSON schema written by WriteConfig.  Databases written
+// before the schema was versioned are version 0.
+const SchemaVersion = 10
+
+// A migration upgrades the top level fields of a database by one schema version
+type migration func(fields map[string]json.RawMessage) error
+
+// Migrations indexed by the schema version they upgrade from
+var migrations = map[uint32]migration{
+	0: func(fields map[string]json.RawMessage) error {
+		// version 1 only introduced the version field
+		return nil
+	},
+	1: func(fields map[string]json.RawMessage) error {
+		// version 2 added optional password entry metadata; the bump stops
+		// older releases from dropping it when they save
+		return nil
+	},
+	2: func(fields map[string]json.RawMessage) error {
+		// version 3 added optional totp algorithm, digits and period
+		return nil
+	},
+	3: func(fields map[string]json.RawMessage) error {
+		// version 4 added the optional totp issuer
+		return nil
+	},
+	4: func(fields map[string]json.RawMessage) error {
+		// version 5 added hotp accounts whose counters older releases
+		// wouldn't advance
+		return nil
+	},
+	5: func(fields map[string]json.RawMessage) error {
+		// version 6 added the totp T0 and clock offset which older releases
+		// would ignore and generate the wrong tokens
+		return nil
+	},
+	6: func(fields map[string]json.RawMessage) error {
+		// version 7 added non-decimal totp code encodings
+		return nil
+	},
+	7: func(fields map[string]json.RawMessage) error {
+		// version 8 added ocra accounts
+		return nil
+	},
+	8: func(fields map[string]json.RawMessage) error {
+		// version 9 added backup codes whose used flags older releases
+		// would drop
+		return nil
+	},
+	9: func(fields map[string]json.RawMessage) error {
+		// version 10 added password history
+		return nil
+	},
+}
+
+// Upgrade a JSON encoded database to the current schema version
+func Migrate(blob []byte) ([]byte, error) {
+	blob, _, err := migrate(blob)
+	return blob, err
+}
+
+// upgrade a JSON encoded database also returning the version it was at
+func migrate(blob []byte) ([]byte, uint32, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(blob, &fields); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", InvalidJSONError, err)
+	}
+
+	var version uint32
+	if raw, ok := fields["Version"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil {
+			return nil, 0, fmt.Errorf("%w: %v", InvalidJSONError, err)
+		}
+	}
+	if version > SchemaVersion {
+		return nil, 0, UnsupportedVersionError
+	}
+	if version == SchemaVersion {
+		return blob, version, nil
+	}
+
+	var original = version
+	for ; version < SchemaVersion; version++ {
+		migrate, ok := migrations[version]
+		if !ok {
+			return nil, 0, fmt.Errorf("no migration from schema version %d", version)
+		}
+		if err := migrate(fields); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	raw, err := json.Marshal(version)
+	if err != nil {
+		return nil, 0, err
+	}
+	fields["Version"] = raw
+	blob, err = json.Marshal(fields)
+	return blob, original, err
+}
@@ -0,0 +1,23 @@
+package pwdb
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateUnversionedDb(t *testing.T) {
+	var blob = []byte(`{"TotpAccounts":{},"Passwords":{"Something":{"Username":"user","Password":"secret"}}}`)
+	var content = append(append([]byte{}, legacyMagicId...), blob...)
+	c, err := ReadConfig(bytes.NewReader(content), nil)
+	assert.NoError(t, err, "Read failed")
+	assert.Equal(t, uint32(SchemaVersion), c.Version)
+	assert.Equal(t, "secret", c.Passwords["Something"].Password)
+}
+
+func TestMigrateFutureVersion(t *testing.T) {
+	_, err := Migrate([]byte(`{"Version":1000}`))
+	assert.True(t, errors.Is(err, UnsupportedVersionError), "Migrate succeeded")
+}
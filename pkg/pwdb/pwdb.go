@@ -1,23 +1,167 @@
 package pwdb
 
-// Totp Entry
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Kinds of one time password accounts
+const (
+	TotpType = "totp"
+	HotpType = "hotp"
+	OcraType = "ocra"
+)
+
+// Totp Entry; also holds counter based (hotp) and challenge-response (ocra)
+// accounts
 type TotpEntry struct {
-	Secret string // base32 encoded secret
+	Type      string `json:",omitempty"` // TotpType if empty
+	Secret    string // base32 encoded secret
+	Algorithm string `json:",omitempty"` // SHA1 if empty
+	Digits    int    `json:",omitempty"` // 6 if zero
+	Period    int64  `json:",omitempty"` // seconds; 30 if zero
+	Issuer    string `json:",omitempty"`
+	Counter   uint64 `json:",omitempty"` // counter of the next hotp token
+	T0        int64  `json:",omitempty"` // unix time totp steps are counted from
+	Offset    int64  `json:",omitempty"` // seconds added to the clock for a drifting clock
+	Encoding  string `json:",omitempty"` // how codes are shown; decimal if empty
+	Alphabet  string `json:",omitempty"` // symbols of the alphabet encoding
+	Suite     string `json:",omitempty"` // ocra suite e.g. OCRA-1:HOTP-SHA1-6:QN08
+
+	BackupCodes []BackupCode `json:",omitempty"` // recovery codes issued at enrollment
+}
+
+var NoBackupCodeError = errors.New("no such backup code")
+var BackupCodeUsedError = errors.New("backup code already used")
+
+// One time recovery code for when the second factor is unavailable
+type BackupCode struct {
+	Code   string
+	Used   bool
+	UsedAt time.Time
+}
+
+// codes compare ignoring case, spaces and hyphens since providers group them
+func normalizeBackupCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+// The number of backup codes not yet used
+func (entry TotpEntry) UnusedBackupCodes() int {
+	var count = 0
+	for _, code := range entry.BackupCodes {
+		if !code.Used {
+			count++
+		}
+	}
+	return count
+}
+
+// Mark a backup code as used
+func (entry *TotpEntry) UseBackupCode(code string, at time.Time) error {
+	for i := range entry.BackupCodes {
+		var backupCode = &entry.BackupCodes[i]
+		if normalizeBackupCode(backupCode.Code) != normalizeBackupCode(code) {
+			continue
+		}
+		if backupCode.Used {
+			return BackupCodeUsedError
+		}
+		backupCode.Used = true
+		backupCode.UsedAt = at.UTC()
+		return nil
+	}
+	return NoBackupCodeError
+}
+
+// True for time based accounts
+func (entry TotpEntry) IsTotp() bool {
+	return entry.Type == "" || entry.Type == TotpType
+}
+
+// True for counter based accounts
+func (entry TotpEntry) IsHotp() bool {
+	return entry.Type == HotpType
+}
+
+// True for challenge-response accounts
+func (entry TotpEntry) IsOcra() bool {
+	return entry.Type == OcraType
+}
+
+// Custom field of a password entry e.g. a security question or account number
+type Field struct {
+	Name      string
+	Value     string
+	Sensitive bool `json:",omitempty"` // hidden unless asked for
+}
+
+// How many previous passwords an entry keeps
+const HistoryLength = 10
+
+// A previous password of an entry
+type PasswordHistory struct {
+	Password string
+	Changed  time.Time // when it was replaced
 }
 
 // Password Entry
 type PasswordEntry struct {
 	Username string
 	Password string
+	URLs     []string `json:",omitempty"`
+	Notes    string   `json:",omitempty"`
+	Tags     []string `json:",omitempty"`
+	Fields   []Field  `json:",omitempty"`
+	Created  time.Time
+	Modified time.Time
+	Accessed time.Time
+	History  []PasswordHistory `json:",omitempty"` // previous passwords newest first
+}
+
+// Get a custom field by name
+func (entry PasswordEntry) Field(name string) (Field, bool) {
+	for _, field := range entry.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return Field{}, false
+}
+
+// Add or replace a custom field
+func (entry *PasswordEntry) SetField(name string, value string, sensitive bool) {
+	var field = Field{Name: name, Value: value, Sensitive: sensitive}
+	for i := range entry.Fields {
+		if entry.Fields[i].Name == name {
+			entry.Fields[i] = field
+			return
+		}
+	}
+	entry.Fields = append(entry.Fields, field)
+}
+
+// Remove a custom field returning false if it didn't exist
+func (entry *PasswordEntry) RemoveField(name string) bool {
+	for i := range entry.Fields {
+		if entry.Fields[i].Name == name {
+			entry.Fields = append(entry.Fields[:i], entry.Fields[i+1:]...)
+			return true
+		}
+	}
+	return false
 }
 
 type Database struct {
+	Version      uint32 // schema version
 	TotpAccounts map[string]TotpEntry
 	Passwords    map[string]PasswordEntry
 }
 
 func NewDatabase() *Database {
 	return &Database{
+		Version:      SchemaVersion,
 		TotpAccounts: make(map[string]TotpEntry),
 		Passwords:    make(map[string]PasswordEntry),
 	}
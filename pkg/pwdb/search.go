@@ -0,0 +1,171 @@
+package pwdb
+
+import (
+	"sort"
+	"strings"
+)
+
+// How well a query matched, best first
+const (
+	exactScore       = 100
+	prefixScore      = 80
+	substringScore   = 60
+	subsequenceScore = 40
+	typoScore        = 20
+)
+
+// name matches rank above equally good matches of other fields
+const nameBonus = 5
+
+// A search result
+type Match struct {
+	Name  string // account name
+	Field string // the field that matched e.g. Username
+	Value string // the matched value
+	Score int
+}
+
+// True if the query is contained in the matched value rather than the value
+// merely resembling it
+func (match Match) Strong() bool {
+	return match.Score >= substringScore
+}
+
+// Score how well a query matches a value ignoring case; zero if it doesn't
+func fuzzyScore(query string, value string) int {
+	query, value = strings.ToLower(query), strings.ToLower(value)
+	switch {
+	case query == "" || value == "":
+		return 0
+	case query == value:
+		return exactScore
+	case strings.HasPrefix(value, query):
+		return prefixScore
+	case strings.Contains(value, query):
+		return substringScore
+	case isSubsequence(query, value):
+		return subsequenceScore
+	}
+	var distance = editDistance([]rune(query), []rune(value))
+	var allowed = len([]rune(query)) / 3
+	if allowed < 1 {
+		allowed = 1
+	}
+	if distance <= allowed {
+		return typoScore - distance
+	}
+	return 0
+}
+
+// true if the query's characters appear in order in the value
+func isSubsequence(query string, value string) bool {
+	var remaining = []rune(query)
+	for _, r := range value {
+		if len(remaining) > 0 && r == remaining[0] {
+			remaining = remaining[1:]
+		}
+	}
+	return len(remaining) == 0
+}
+
+// the edit distance between two strings counting swapped neighbours as one
+// edit since that's the commonest typo
+func editDistance(a []rune, b []rune) int {
+	var d = make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			var cost = 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func min(values ...int) int {
+	var result = values[0]
+	for _, value := range values[1:] {
+		if value < result {
+			result = value
+		}
+	}
+	return result
+}
+
+// the best match of a query against an account's fields
+type matcher struct {
+	query string
+	best  Match
+}
+
+func (m *matcher) try(field string, value string, bonus int) {
+	var score = fuzzyScore(m.query, value)
+	if score > 0 && score+bonus > m.best.Score {
+		m.best = Match{Name: m.best.Name, Field: field, Value: value, Score: score + bonus}
+	}
+}
+
+// the name and the last part of its path so "prod" finds work/aws/prod
+func (m *matcher) tryName(name string) {
+	m.try("Name", name, nameBonus)
+	if i := strings.LastIndex(name, FolderSeparator); i >= 0 {
+		m.try("Name", name[i+1:], nameBonus)
+	}
+}
+
+// sort matches best first then by name
+func sortMatches(matches []Match) []Match {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Name < matches[j].Name
+	})
+	return matches
+}
+
+// Search the password entries' names, usernames, URLs and tags
+func (vault *Vault) SearchPasswords(query string) []Match {
+	var matches []Match
+	for name, entry := range vault.db.Passwords {
+		var m = matcher{query: query, best: Match{Name: name}}
+		m.tryName(name)
+		m.try("Username", entry.Username, 0)
+		for _, url := range entry.URLs {
+			m.try("URL", url, 0)
+		}
+		for _, tag := range entry.Tags {
+			m.try("Tag", tag, 0)
+		}
+		if m.best.Score > 0 {
+			matches = append(matches, m.best)
+		}
+	}
+	return sortMatches(matches)
+}
+
+// Search the totp entries' names and issuers
+func (vault *Vault) SearchTotp(query string) []Match {
+	var matches []Match
+	for name, entry := range vault.db.TotpAccounts {
+		var m = matcher{query: query, best: Match{Name: name}}
+		m.tryName(name)
+		m.try("Issuer", entry.Issuer, 0)
+		if m.best.Score > 0 {
+			matches = append(matches, m.best)
+		}
+	}
+	return sortMatches(matches)
+}
@@ -0,0 +1,56 @@
+package pwdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	assert.Equal(t, exactScore, fuzzyScore("GitHub", "github"))
+	assert.Equal(t, prefixScore, fuzzyScore("git", "github"))
+	assert.Equal(t, substringScore, fuzzyScore("hub", "github"))
+	assert.Equal(t, subsequenceScore, fuzzyScore("gthb", "github"))
+	assert.Equal(t, typoScore-1, fuzzyScore("gihtub", "github"))
+	assert.Equal(t, typoScore-2, fuzzyScore("gtihbu", "github"))
+	assert.Equal(t, 0, fuzzyScore("gitlab", "bitbucket"))
+	assert.Equal(t, 0, fuzzyScore("", "github"))
+}
+
+func TestVaultSearch(t *testing.T) {
+	tempFolder, err := ioutil.TempDir("", "pwdb")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempFolder)
+
+	vault, err := Open(filepath.Join(tempFolder, "accounts"), nil)
+	assert.NoError(t, err)
+	defer vault.Close()
+	vault.PutPassword("work/github", PasswordEntry{Username: "alice"})
+	vault.PutPassword("personal/mail", PasswordEntry{Username: "alice@example.com", Tags: []string{"email"}})
+	vault.PutPassword("bank", PasswordEntry{URLs: []string{"https://bank.example.com"}})
+	vault.PutTotp("gh", TotpEntry{Issuer: "GitHub"})
+
+	var matches = vault.SearchPasswords("alice")
+	assert.Len(t, matches, 2)
+	assert.Equal(t, Match{Name: "work/github", Field: "Username", Value: "alice", Score: exactScore}, matches[0])
+	assert.Equal(t, "personal/mail", matches[1].Name)
+	assert.True(t, matches[1].Strong())
+
+	// the last part of a path is matched on its own
+	matches = vault.SearchPasswords("github")
+	assert.Equal(t, "work/github", matches[0].Name)
+	assert.Equal(t, exactScore+nameBonus, matches[0].Score)
+
+	matches = vault.SearchPasswords("example.com")
+	assert.Len(t, matches, 2)
+	matches = vault.SearchPasswords("emial")
+	assert.Len(t, matches, 1)
+	assert.False(t, matches[0].Strong())
+	assert.Empty(t, vault.SearchPasswords("nothing"))
+
+	matches = vault.SearchTotp("github")
+	assert.Equal(t, []Match{{Name: "gh", Field: "Issuer", Value: "GitHub", Score: exactScore}}, matches)
+}
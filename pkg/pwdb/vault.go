@@ -0,0 +1,281 @@
+package pwdb
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"time"
+)
+
+// How long Open waits for another process to release the database
+var LockTimeout = 5 * time.Minute
+
+var NoEntryError = errors.New("no such entry")
+var EntryExistsError = errors.New("entry already exists")
+var NoHistoryError = errors.New("no such previous password")
+
+// Supplies the passphrase of an encrypted database
+type Unlocker interface {
+	Passphrase() ([]byte, error)
+}
+
+// Adapts a function to the Unlocker interface
+type UnlockerFunc func() ([]byte, error)
+
+func (f UnlockerFunc) Passphrase() ([]byte, error) {
+	return f()
+}
+
+// A database file opened for update.  The vault holds the database lock and
+// the passphrase until it's closed.
+type Vault struct {
+	lock       *Lock
+	db         *Database
+	passphrase []byte
+	isNew      bool
+}
+
+// Lock and load the database at the given location.  The unlocker is only
+// asked for a passphrase if the database is encrypted, which fails with
+// DatabaseEncryptedError if the unlocker is nil; a database that
+// doesn't exist yet is created empty and written on Save.
+func Open(path string, unlocker Unlocker) (*Vault, error) {
+	lock, err := LockConfig(path, LockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	vault, err := OpenLocked(lock, unlocker)
+	if err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+	return vault, nil
+}
+
+// Load the database through a lock the caller already holds.  The vault
+// takes ownership of the lock.
+func OpenLocked(lock *Lock, unlocker Unlocker) (*Vault, error) {
+	var vault = &Vault{lock: lock}
+	var exists = fileExists(lock.path)
+	if exists && IsEncrypted(lock.path) {
+		if unlocker == nil {
+			return nil, DatabaseEncryptedError
+		}
+		passphrase, err := unlocker.Passphrase()
+		if err != nil {
+			return nil, err
+		}
+		vault.passphrase = passphrase
+	}
+
+	db, err := lock.Load(vault.passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if db.Passwords == nil {
+		db.Passwords = make(map[string]PasswordEntry)
+	}
+	if db.TotpAccounts == nil {
+		db.TotpAccounts = make(map[string]TotpEntry)
+	}
+	vault.db = db
+	vault.isNew = !exists
+	return vault, nil
+}
+
+// True if the database file didn't exist when the vault was opened and
+// hasn't been saved since
+func (vault *Vault) IsNew() bool {
+	return vault.isNew
+}
+
+// The location of the database file
+func (vault *Vault) Path() string {
+	return vault.lock.path
+}
+
+// The underlying database
+func (vault *Vault) Database() *Database {
+	return vault.db
+}
+
+// Get a password entry
+func (vault *Vault) GetPassword(name string) (PasswordEntry, bool) {
+	entry, ok := vault.db.Passwords[name]
+	return entry, ok
+}
+
+// Add or replace a password entry updating its timestamps.  A replaced
+// password is added to the entry's history.
+func (vault *Vault) PutPassword(name string, entry PasswordEntry) {
+	var now = time.Now().UTC()
+	existing, exists := vault.db.Passwords[name]
+	if entry.Created.IsZero() {
+		if exists && !existing.Created.IsZero() {
+			entry.Created = existing.Created
+		} else {
+			entry.Created = now
+		}
+	}
+	if exists && existing.Password != entry.Password {
+		var previous = PasswordHistory{Password: existing.Password, Changed: now}
+		entry.History = append([]PasswordHistory{previous}, existing.History...)
+		if len(entry.History) > HistoryLength {
+			entry.History = entry.History[:HistoryLength]
+		}
+	}
+	entry.Modified = now
+	vault.db.Passwords[name] = entry
+}
+
+// Restore a previous password of an entry, 1 being the most recent; the
+// current password joins the history
+func (vault *Vault) RevertPassword(name string, n int) error {
+	entry, ok := vault.db.Passwords[name]
+	if !ok {
+		return NoEntryError
+	}
+	if n < 1 || n > len(entry.History) {
+		return NoHistoryError
+	}
+	entry.Password = entry.History[n-1].Password
+	vault.PutPassword(name, entry)
+	return nil
+}
+
+// Record that a password entry was read returning false if it doesn't exist
+func (vault *Vault) TouchPassword(name string) bool {
+	entry, ok := vault.db.Passwords[name]
+	if ok {
+		entry.Accessed = time.Now().UTC()
+		vault.db.Passwords[name] = entry
+	}
+	return ok
+}
+
+// Remove a password entry returning false if it didn't exist
+func (vault *Vault) DeletePassword(name string) bool {
+	_, ok := vault.db.Passwords[name]
+	delete(vault.db.Passwords, name)
+	return ok
+}
+
+// Rename a password entry keeping its timestamps
+func (vault *Vault) RenamePassword(from string, to string) error {
+	entry, ok := vault.db.Passwords[from]
+	if !ok {
+		return NoEntryError
+	}
+	if _, exists := vault.db.Passwords[to]; exists {
+		return EntryExistsError
+	}
+	delete(vault.db.Passwords, from)
+	vault.db.Passwords[to] = entry
+	return nil
+}
+
+// Sorted names of the password entries
+func (vault *Vault) ListPasswords() []string {
+	var names = make([]string, 0, len(vault.db.Passwords))
+	for name := range vault.db.Passwords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get a totp entry
+func (vault *Vault) GetTotp(name string) (TotpEntry, bool) {
+	entry, ok := vault.db.TotpAccounts[name]
+	return entry, ok
+}
+
+// Add or replace a totp entry
+func (vault *Vault) PutTotp(name string, entry TotpEntry) {
+	vault.db.TotpAccounts[name] = entry
+}
+
+// Remove a totp entry returning false if it didn't exist
+func (vault *Vault) DeleteTotp(name string) bool {
+	_, ok := vault.db.TotpAccounts[name]
+	delete(vault.db.TotpAccounts, name)
+	return ok
+}
+
+// Rename a totp entry
+func (vault *Vault) RenameTotp(from string, to string) error {
+	entry, ok := vault.db.TotpAccounts[from]
+	if !ok {
+		return NoEntryError
+	}
+	if _, exists := vault.db.TotpAccounts[to]; exists {
+		return EntryExistsError
+	}
+	delete(vault.db.TotpAccounts, from)
+	vault.db.TotpAccounts[to] = entry
+	return nil
+}
+
+// Sorted names of the totp entries
+func (vault *Vault) ListTotp() []string {
+	var names = make([]string, 0, len(vault.db.TotpAccounts))
+	for name := range vault.db.TotpAccounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Set the passphrase used by the next Save; nil or empty removes encryption.
+// The vault keeps its own copy of the passphrase.
+func (vault *Vault) ChangePassphrase(passphrase []byte) {
+	if len(passphrase) == 0 {
+		vault.passphrase = nil
+	} else {
+		vault.passphrase = append([]byte{}, passphrase...)
+	}
+}
+
+// Write the database back to its file
+func (vault *Vault) Save() error {
+	if err := vault.lock.Save(vault.db, vault.passphrase); err != nil {
+		return err
+	}
+	vault.isNew = false
+	return nil
+}
+
+// The file format and schema versions of the database as it was loaded
+func (vault *Vault) Versions() (uint32, uint32) {
+	return vault.lock.version, vault.lock.schema
+}
+
+// True if the database was loaded from an older file format or schema and
+// Save would upgrade it
+func (vault *Vault) NeedsUpgrade() bool {
+	return !vault.isNew && (vault.lock.version != CurrentFileVersion || vault.lock.schema != SchemaVersion)
+}
+
+// Save changes to access times alone.  No backup is made since it would only
+// differ in access times, and a database in an older file format or schema
+// is left as it is rather than upgraded behind the user's back.
+func (vault *Vault) SaveAccessed() error {
+	if vault.isNew || vault.NeedsUpgrade() {
+		return nil
+	}
+	return vault.lock.SaveInPlace(vault.db, vault.passphrase)
+}
+
+// Release the lock and forget the passphrase.  Unsaved changes are discarded.
+func (vault *Vault) Close() error {
+	for i := range vault.passphrase {
+		vault.passphrase[i] = 0
+	}
+	vault.passphrase = nil
+	return vault.lock.Unlock()
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return !os.IsNotExist(err)
+}
@@ -0,0 +1,324 @@
+package pwdb
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVaultRoundTrip(t *testing.T) {
+	tempFolder, err := ioutil.TempDir("", "pwdb")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempFolder)
+	var tempFile = filepath.Join(tempFolder, "accounts")
+	var secret = []byte("some secret password")
+	var unlocker = UnlockerFunc(func() ([]byte, error) {
+		return append([]byte{}, secret...), nil
+	})
+
+	vault, err := Open(tempFile, unlocker)
+	assert.NoError(t, err)
+	assert.True(t, vault.IsNew())
+	vault.PutPassword("b", PasswordEntry{Username: "user", Password: "pass"})
+	vault.PutPassword("a", PasswordEntry{Username: "user", Password: "pass"})
+	vault.PutTotp("c", TotpEntry{Secret: "secret"})
+	vault.ChangePassphrase(secret)
+	assert.NoError(t, vault.Save())
+	assert.False(t, vault.IsNew())
+	assert.NoError(t, vault.Close())
+	assert.True(t, IsEncrypted(tempFile))
+
+	vault, err = Open(tempFile, unlocker)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, vault.ListPasswords())
+	assert.Equal(t, []string{"c"}, vault.ListTotp())
+	entry, ok := vault.GetPassword("a")
+	assert.True(t, ok)
+	assert.Equal(t, "pass", entry.Password)
+	assert.True(t, vault.DeletePassword("a"))
+	assert.False(t, vault.DeletePassword("a"))
+
+	// remove the passphrase
+	vault.ChangePassphrase(nil)
+	assert.NoError(t, vault.Save())
+	assert.NoError(t, vault.Close())
+	assert.False(t, IsEncrypted(tempFile))
+}
+
+func TestVaultUnlockerError(t *testing.T) {
+	tempFolder, err := ioutil.TempDir("", "pwdb")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempFolder)
+	var tempFile = filepath.Join(tempFolder, "accounts")
+	assert.NoError(t, SaveConfig(tempFile, NewDatabase(), []byte("secret")))
+
+	var cancelled = errors.New("cancelled")
+	_, err = Open(tempFile, UnlockerFunc(func() ([]byte, error) {
+		return nil, cancelled
+	}))
+	assert.True(t, errors.Is(err, cancelled))
+
+	// the lock was released
+	lock, err := LockConfig(tempFile, 0)
+	assert.NoError(t, err)
+	lock.Unlock()
+}
+
+func TestVaultNilUnlocker(t *testing.T) {
+	tempFolder, err := ioutil.TempDir("", "pwdb")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempFolder)
+	var tempFile = filepath.Join(tempFolder, "accounts")
+	assert.NoError(t, SaveConfig(tempFile, NewDatabase(), []byte("secret")))
+
+	_, err = Open(tempFile, nil)
+	assert.True(t, errors.Is(err, DatabaseEncryptedError))
+
+	// the lock was released
+	lock, err := LockConfig(tempFile, 0)
+	assert.NoError(t, err)
+	lock.Unlock()
+}
+
+func TestVaultEntryMetadata(t *testing.T) {
+	tempFolder, err := ioutil.TempDir("", "pwdb")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempFolder)
+	var tempFile = filepath.Join(tempFolder, "accounts")
+
+	vault, err := Open(tempFile, nil)
+	assert.NoError(t, err)
+	var entry = PasswordEntry{
+		Username: "user",
+		Password: "pass",
+		URLs:     []string{"https://example.com"},
+		Notes:    "some notes",
+		Tags:     []string{"work"},
+	}
+	entry.SetField("account number", "1234", false)
+	entry.SetField("security question", "blue", true)
+	vault.PutPassword("a", entry)
+	created, _ := vault.GetPassword("a")
+	assert.False(t, created.Created.IsZero())
+	assert.Equal(t, created.Created, created.Modified)
+	assert.True(t, vault.TouchPassword("a"))
+	assert.NoError(t, vault.Save())
+	assert.NoError(t, vault.Close())
+
+	vault, err = Open(tempFile, nil)
+	assert.NoError(t, err)
+	defer vault.Close()
+	loaded, ok := vault.GetPassword("a")
+	assert.True(t, ok)
+	assert.Equal(t, entry.URLs, loaded.URLs)
+	assert.Equal(t, entry.Tags, loaded.Tags)
+	assert.Equal(t, entry.Notes, loaded.Notes)
+	field, ok := loaded.Field("security question")
+	assert.True(t, ok)
+	assert.True(t, field.Sensitive)
+	assert.True(t, created.Created.Equal(loaded.Created))
+	assert.False(t, loaded.Accessed.IsZero())
+
+	// replacing the entry keeps its creation time
+	loaded.Password = "new pass"
+	vault.PutPassword("a", loaded)
+	updated, _ := vault.GetPassword("a")
+	assert.True(t, created.Created.Equal(updated.Created))
+	assert.True(t, updated.Modified.After(created.Modified) || updated.Modified.Equal(created.Modified))
+}
+
+func TestVaultSaveAccessedKeepsBackups(t *testing.T) {
+	tempFolder, err := ioutil.TempDir("", "pwdb")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempFolder)
+	var tempFile = filepath.Join(tempFolder, "accounts")
+
+	vault, err := Open(tempFile, nil)
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		vault.PutPassword("a", PasswordEntry{Password: strconv.Itoa(i)})
+		assert.NoError(t, vault.Save())
+	}
+	assert.NoError(t, vault.Close())
+	before, err := ListBackups(tempFile)
+	assert.NoError(t, err)
+	assert.Len(t, before, 1)
+
+	// reading an entry repeatedly records the access without rotating backups
+	for i := 0; i < BackupCount+1; i++ {
+		vault, err = Open(tempFile, nil)
+		assert.NoError(t, err)
+		assert.True(t, vault.TouchPassword("a"))
+		assert.NoError(t, vault.SaveAccessed())
+		assert.NoError(t, vault.Close())
+	}
+	after, err := ListBackups(tempFile)
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+	vault, err = Open(tempFile, nil)
+	assert.NoError(t, err)
+	defer vault.Close()
+	entry, _ := vault.GetPassword("a")
+	assert.False(t, entry.Accessed.IsZero())
+	assert.Equal(t, "1", entry.Password)
+}
+
+func TestVaultSaveAccessedLeavesOldFormat(t *testing.T) {
+	tempFolder, err := ioutil.TempDir("", "pwdb")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempFolder)
+	var tempFile = filepath.Join(tempFolder, "accounts")
+
+	var db = NewDatabase()
+	db.Passwords["a"] = PasswordEntry{Password: "pass"}
+	// an older file format and the current format with an older schema
+	olderSchema, err := fileFormats[CurrentFileVersion].write(
+		[]byte(`{"Version":9,"Passwords":{"a":{"Password":"pass"}}}`), nil)
+	assert.NoError(t, err)
+	for _, content := range [][]byte{writeLegacyConfig(t, db, nil), olderSchema} {
+		assert.NoError(t, ioutil.WriteFile(tempFile, content, 0600))
+		vault, err := Open(tempFile, nil)
+		assert.NoError(t, err)
+		assert.True(t, vault.TouchPassword("a"))
+		assert.NoError(t, vault.SaveAccessed())
+		assert.NoError(t, vault.Close())
+		saved, err := ioutil.ReadFile(tempFile)
+		assert.NoError(t, err)
+		assert.Equal(t, content, saved)
+	}
+}
+
+func TestVaultNeedsUpgrade(t *testing.T) {
+	tempFolder, err := ioutil.TempDir("", "pwdb")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempFolder)
+	var tempFile = filepath.Join(tempFolder, "accounts")
+
+	// the current file format with an older schema
+	content, err := fileFormats[CurrentFileVersion].write([]byte(`{"Version":9}`), nil)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(tempFile, content, 0600))
+	vault, err := Open(tempFile, nil)
+	assert.NoError(t, err)
+	assert.True(t, vault.NeedsUpgrade())
+	version, schema := vault.Versions()
+	assert.Equal(t, uint32(CurrentFileVersion), version)
+	assert.Equal(t, uint32(9), schema)
+	assert.NoError(t, vault.Save())
+	assert.False(t, vault.NeedsUpgrade())
+	assert.NoError(t, vault.Close())
+
+	vault, err = Open(tempFile, nil)
+	assert.NoError(t, err)
+	defer vault.Close()
+	assert.False(t, vault.NeedsUpgrade())
+	backups, err := ListBackups(tempFile)
+	assert.NoError(t, err)
+	assert.Len(t, backups, 1)
+}
+
+func TestVaultBackupCodes(t *testing.T) {
+	tempFolder, err := ioutil.TempDir("", "pwdb")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempFolder)
+	var tempFile = filepath.Join(tempFolder, "accounts")
+
+	vault, err := Open(tempFile, nil)
+	assert.NoError(t, err)
+	var entry = TotpEntry{
+		Secret:      "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		BackupCodes: []BackupCode{{Code: "abcd-efgh"}, {Code: "1234 5678"}},
+	}
+	var used = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.NoError(t, entry.UseBackupCode("ABCDEFGH", used))
+	assert.Equal(t, BackupCodeUsedError, entry.UseBackupCode("abcd-efgh", used))
+	assert.Equal(t, NoBackupCodeError, entry.UseBackupCode("0000", used))
+	assert.Equal(t, 1, entry.UnusedBackupCodes())
+	vault.PutTotp("a", entry)
+	assert.NoError(t, vault.Save())
+	assert.NoError(t, vault.Close())
+
+	vault, err = Open(tempFile, nil)
+	assert.NoError(t, err)
+	defer vault.Close()
+	loaded, ok := vault.GetTotp("a")
+	assert.True(t, ok)
+	assert.True(t, loaded.BackupCodes[0].Used)
+	assert.True(t, used.Equal(loaded.BackupCodes[0].UsedAt))
+	assert.False(t, loaded.BackupCodes[1].Used)
+}
+
+func TestVaultRename(t *testing.T) {
+	tempFolder, err := ioutil.TempDir("", "pwdb")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempFolder)
+
+	vault, err := Open(filepath.Join(tempFolder, "accounts"), nil)
+	assert.NoError(t, err)
+	defer vault.Close()
+	vault.PutPassword("a", PasswordEntry{Username: "user", Password: "pass"})
+	vault.PutPassword("b", PasswordEntry{Username: "other", Password: "pass"})
+	created, _ := vault.GetPassword("a")
+
+	assert.NoError(t, vault.RenamePassword("a", "c"))
+	_, ok := vault.GetPassword("a")
+	assert.False(t, ok)
+	renamed, ok := vault.GetPassword("c")
+	assert.True(t, ok)
+	assert.Equal(t, created, renamed)
+	assert.Equal(t, EntryExistsError, vault.RenamePassword("c", "b"))
+	assert.Equal(t, NoEntryError, vault.RenamePassword("a", "d"))
+
+	vault.PutTotp("x", TotpEntry{Secret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"})
+	assert.NoError(t, vault.RenameTotp("x", "y"))
+	assert.Equal(t, []string{"y"}, vault.ListTotp())
+	assert.Equal(t, NoEntryError, vault.RenameTotp("x", "z"))
+}
+
+func TestVaultPasswordHistory(t *testing.T) {
+	tempFolder, err := ioutil.TempDir("", "pwdb")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempFolder)
+
+	vault, err := Open(filepath.Join(tempFolder, "accounts"), nil)
+	assert.NoError(t, err)
+	defer vault.Close()
+	vault.PutPassword("a", PasswordEntry{Username: "user", Password: "first"})
+	entry, _ := vault.GetPassword("a")
+	assert.Empty(t, entry.History)
+
+	// only password changes are recorded
+	entry.Notes = "notes"
+	vault.PutPassword("a", entry)
+	entry, _ = vault.GetPassword("a")
+	assert.Empty(t, entry.History)
+
+	entry.Password = "second"
+	vault.PutPassword("a", entry)
+	entry, _ = vault.GetPassword("a")
+	assert.Len(t, entry.History, 1)
+	assert.Equal(t, "first", entry.History[0].Password)
+	assert.False(t, entry.History[0].Changed.IsZero())
+
+	assert.NoError(t, vault.RevertPassword("a", 1))
+	entry, _ = vault.GetPassword("a")
+	assert.Equal(t, "first", entry.Password)
+	assert.Equal(t, "second", entry.History[0].Password)
+	assert.Equal(t, NoHistoryError, vault.RevertPassword("a", 3))
+	assert.Equal(t, NoEntryError, vault.RevertPassword("b", 1))
+
+	// the history is bounded
+	for i := 0; i < HistoryLength+5; i++ {
+		entry.Password = strconv.Itoa(i)
+		vault.PutPassword("a", entry)
+	}
+	entry, _ = vault.GetPassword("a")
+	assert.Len(t, entry.History, HistoryLength)
+	assert.Equal(t, strconv.Itoa(HistoryLength+3), entry.History[0].Password)
+}
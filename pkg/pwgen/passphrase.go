@@ -0,0 +1,121 @@
+package pwgen
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Rules for generating a diceware style passphrase
+type PassphrasePolicy struct {
+	Words      int
+	Separator  string
+	Capitalize bool     // capitalize the first letter of every word
+	Digit      bool     // append a random digit to a random word
+	WordList   []string // nil for the EFF large wordlist
+}
+
+// Six words from the EFF large wordlist; about 77 bits
+var DefaultPassphrasePolicy = PassphrasePolicy{Words: 6, Separator: "-"}
+
+var effWords = strings.Fields(effLargeWordList)
+
+// The EFF large wordlist
+func EFFLargeWordList() []string {
+	return append([]string{}, effWords...)
+}
+
+// Read a word list with one word per line.  Lines in the diceware format
+// "11111 word" use the last field; blank lines and duplicate words are skipped.
+func LoadWordList(reader io.Reader) ([]string, error) {
+	var words []string
+	var seen = make(map[string]bool)
+	var scanner = bufio.NewScanner(reader)
+	for scanner.Scan() {
+		var fields = strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var word = fields[len(fields)-1]
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(words) < 2 {
+		return nil, fmt.Errorf("%w: word list needs at least two distinct words", InvalidPolicyError)
+	}
+	return words, nil
+}
+
+func (policy PassphrasePolicy) words() ([]string, error) {
+	if policy.Words <= 0 {
+		return nil, fmt.Errorf("%w: word count must be positive", InvalidPolicyError)
+	}
+	if policy.WordList == nil {
+		return effWords, nil
+	}
+	if len(policy.WordList) < 2 {
+		return nil, fmt.Errorf("%w: word list needs at least two distinct words", InvalidPolicyError)
+	}
+	return policy.WordList, nil
+}
+
+func capitalize(word string) string {
+	first, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToUpper(first)) + word[size:]
+}
+
+// Generate a passphrase following the policy
+func GeneratePassphrase(policy PassphrasePolicy) (string, error) {
+	list, err := policy.words()
+	if err != nil {
+		return "", err
+	}
+
+	var words = make([]string, policy.Words)
+	for i := range words {
+		j, err := randomInt(len(list))
+		if err != nil {
+			return "", err
+		}
+		words[i] = list[j]
+		if policy.Capitalize {
+			words[i] = capitalize(words[i])
+		}
+	}
+
+	if policy.Digit {
+		i, err := randomInt(len(words))
+		if err != nil {
+			return "", err
+		}
+		digit, err := randomRune([]rune(Digits))
+		if err != nil {
+			return "", err
+		}
+		words[i] += string(digit)
+	}
+	return strings.Join(words, policy.Separator), nil
+}
+
+// Bits of entropy of passphrases generated with the policy assuming the word
+// list has no duplicates
+func PassphraseEntropy(policy PassphrasePolicy) (float64, error) {
+	list, err := policy.words()
+	if err != nil {
+		return 0, err
+	}
+	var bits = float64(policy.Words) * math.Log2(float64(len(list)))
+	if policy.Digit {
+		bits += math.Log2(float64(len(Digits))) + math.Log2(float64(policy.Words))
+	}
+	return bits, nil
+}
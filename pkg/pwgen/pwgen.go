@@ -0,0 +1,199 @@
+package pwgen
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// Character classes
+const (
+	Lowercase = "abcdefghijklmnopqrstuvwxyz"
+	Uppercase = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	Digits    = "0123456789"
+	Symbols   = "!#$%&()*+,-./:;<=>?@[]^_{}~"
+)
+
+// Characters that are easily mistaken for one another
+const LookAlikes = "Il1|O0o"
+
+var InvalidPolicyError = errors.New("invalid password policy")
+
+// A set of characters and how many of them a password must contain
+type Class struct {
+	Characters string
+	Minimum    int
+}
+
+// Rules for generating a password
+type Policy struct {
+	Length            int
+	Classes           []Class
+	ExcludeLookAlikes bool
+	Exclude           string // additional characters to leave out
+}
+
+// Named policies for common site requirements
+var Presets = map[string]Policy{
+	// long password with every class
+	"default": {Length: 20, Classes: []Class{{Lowercase, 1}, {Uppercase, 1}, {Digits, 1}, {Symbols, 1}}},
+	// for sites that cap the length but want every class
+	"legacy": {Length: 12, Classes: []Class{{Lowercase, 1}, {Uppercase, 1}, {Digits, 1}, {Symbols, 1}}},
+	// for sites that reject symbols
+	"alphanumeric": {Length: 20, Classes: []Class{{Lowercase, 1}, {Uppercase, 1}, {Digits, 1}}},
+	// for passwords read aloud or typed by hand
+	"readable": {Length: 16, Classes: []Class{{Lowercase, 1}, {Uppercase, 1}, {Digits, 1}}, ExcludeLookAlikes: true},
+	// numeric pins
+	"pin":    {Length: 6, Classes: []Class{{Digits, 0}}},
+	"strong": {Length: 32, Classes: []Class{{Lowercase, 2}, {Uppercase, 2}, {Digits, 2}, {Symbols, 2}}},
+}
+
+// Names of the presets in alphabetical order
+func PresetNames() []string {
+	var names = make([]string, 0, len(Presets))
+	for name := range Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get a copy of a preset policy
+func Preset(name string) (Policy, bool) {
+	policy, ok := Presets[name]
+	policy.Classes = append([]Class{}, policy.Classes...)
+	return policy, ok
+}
+
+// A copy of the policy without a class e.g. WithoutClass(Symbols) for sites
+// that reject symbols
+func (policy Policy) WithoutClass(characters string) Policy {
+	var classes []Class
+	for _, class := range policy.Classes {
+		if class.Characters != characters {
+			classes = append(classes, class)
+		}
+	}
+	policy.Classes = classes
+	return policy
+}
+
+// remove excluded and duplicate characters
+func (policy Policy) filter(characters string) string {
+	var exclude = policy.Exclude
+	if policy.ExcludeLookAlikes {
+		exclude += LookAlikes
+	}
+	var result strings.Builder
+	for _, c := range characters {
+		if !strings.ContainsRune(exclude, c) && !strings.ContainsRune(result.String(), c) {
+			result.WriteRune(c)
+		}
+	}
+	return result.String()
+}
+
+// the filtered characters of each class and of all classes together
+func (policy Policy) alphabets() ([]string, string, error) {
+	if policy.Length <= 0 {
+		return nil, "", fmt.Errorf("%w: length must be positive", InvalidPolicyError)
+	}
+	if len(policy.Classes) == 0 {
+		return nil, "", fmt.Errorf("%w: no character classes", InvalidPolicyError)
+	}
+
+	var classes = make([]string, len(policy.Classes))
+	var all string
+	var minimum int
+	for i, class := range policy.Classes {
+		classes[i] = policy.filter(class.Characters)
+		if classes[i] == "" {
+			return nil, "", fmt.Errorf("%w: every character of a class is excluded", InvalidPolicyError)
+		}
+		if class.Minimum < 0 {
+			return nil, "", fmt.Errorf("%w: negative minimum", InvalidPolicyError)
+		}
+		minimum += class.Minimum
+		all += classes[i]
+	}
+	if minimum > policy.Length {
+		return nil, "", fmt.Errorf("%w: minimums exceed the length", InvalidPolicyError)
+	}
+	return classes, policy.filter(all), nil
+}
+
+// uniform random number in [0, n)
+func randomInt(n int) (int, error) {
+	value, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(value.Int64()), nil
+}
+
+// pick a character from the alphabet
+func randomRune(alphabet []rune) (rune, error) {
+	i, err := randomInt(len(alphabet))
+	if err != nil {
+		return 0, err
+	}
+	return alphabet[i], nil
+}
+
+// Generate a password following the policy
+func Generate(policy Policy) (string, error) {
+	classes, all, err := policy.alphabets()
+	if err != nil {
+		return "", err
+	}
+
+	// the minimum from each class then the remainder from any class
+	var password = make([]rune, 0, policy.Length)
+	for i, class := range policy.Classes {
+		for j := 0; j < class.Minimum; j++ {
+			c, err := randomRune([]rune(classes[i]))
+			if err != nil {
+				return "", err
+			}
+			password = append(password, c)
+		}
+	}
+	for len(password) < policy.Length {
+		c, err := randomRune([]rune(all))
+		if err != nil {
+			return "", err
+		}
+		password = append(password, c)
+	}
+
+	// shuffle so the required characters aren't at the start
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := randomInt(i + 1)
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j] = password[j], password[i]
+	}
+	return string(password), nil
+}
+
+// Bits of entropy of passwords generated with the policy.  This is a lower
+// bound; it ignores the positions of the required characters.
+func Entropy(policy Policy) (float64, error) {
+	classes, all, err := policy.alphabets()
+	if err != nil {
+		return 0, err
+	}
+	var bits float64
+	var remaining = policy.Length
+	for i, class := range policy.Classes {
+		bits += float64(class.Minimum) * math.Log2(float64(len([]rune(classes[i]))))
+		remaining -= class.Minimum
+	}
+	bits += float64(remaining) * math.Log2(float64(len([]rune(all))))
+	return bits, nil
+}
@@ -0,0 +1,116 @@
+package pwgen
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func countOf(password string, characters string) int {
+	var count = 0
+	for _, c := range password {
+		if strings.ContainsRune(characters, c) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestGeneratePresets(t *testing.T) {
+	for _, name := range PresetNames() {
+		policy, ok := Preset(name)
+		assert.True(t, ok)
+		for i := 0; i < 100; i++ {
+			password, err := Generate(policy)
+			assert.NoError(t, err, name)
+			assert.Equal(t, policy.Length, len([]rune(password)), name)
+			for _, class := range policy.Classes {
+				assert.True(t, countOf(password, class.Characters) >= class.Minimum, name)
+			}
+			if policy.ExcludeLookAlikes {
+				assert.Equal(t, 0, countOf(password, LookAlikes), name)
+			}
+		}
+	}
+}
+
+func TestGeneratePresetsWithoutSymbols(t *testing.T) {
+	for _, name := range PresetNames() {
+		policy, _ := Preset(name)
+		policy = policy.WithoutClass(Symbols)
+		password, err := Generate(policy)
+		assert.NoError(t, err, name)
+		assert.Equal(t, policy.Length, len([]rune(password)), name)
+		assert.Equal(t, 0, countOf(password, Symbols), name)
+	}
+	// the preset itself is left alone
+	policy, _ := Preset("default")
+	assert.Len(t, policy.WithoutClass(Symbols).Classes, 3)
+	assert.Len(t, Presets["default"].Classes, 4)
+}
+
+func TestGenerateMinimums(t *testing.T) {
+	var policy = Policy{Length: 6, Classes: []Class{{Digits, 3}, {Uppercase, 3}}}
+	password, err := Generate(policy)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, countOf(password, Digits))
+	assert.Equal(t, 3, countOf(password, Uppercase))
+}
+
+func TestInvalidPolicies(t *testing.T) {
+	for _, policy := range []Policy{
+		{Length: 0, Classes: []Class{{Digits, 0}}},
+		{Length: 8},
+		{Length: 2, Classes: []Class{{Digits, 2}, {Lowercase, 1}}},
+		{Length: 8, Classes: []Class{{"01", 0}}, Exclude: "01"},
+	} {
+		_, err := Generate(policy)
+		assert.True(t, errors.Is(err, InvalidPolicyError), "%+v", policy)
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	bits, err := Entropy(Policy{Length: 6, Classes: []Class{{Digits, 0}}})
+	assert.NoError(t, err)
+	assert.InDelta(t, 6*math.Log2(10), bits, 1e-9)
+
+	bits, err = Entropy(Policy{Length: 4, Classes: []Class{{Digits, 1}, {"ab", 0}}})
+	assert.NoError(t, err)
+	assert.InDelta(t, math.Log2(10)+3*math.Log2(12), bits, 1e-9)
+}
+
+func TestGeneratePassphrase(t *testing.T) {
+	assert.Equal(t, 7776, len(EFFLargeWordList()))
+
+	var policy = PassphrasePolicy{Words: 5, Separator: " ", Capitalize: true, Digit: true}
+	passphrase, err := GeneratePassphrase(policy)
+	assert.NoError(t, err)
+	var words = strings.Split(passphrase, " ")
+	assert.Equal(t, 5, len(words))
+	for _, word := range words {
+		assert.True(t, word[0] >= 'A' && word[0] <= 'Z', word)
+	}
+	assert.Equal(t, 1, countOf(passphrase, Digits))
+
+	bits, err := PassphraseEntropy(policy)
+	assert.NoError(t, err)
+	assert.InDelta(t, 5*math.Log2(7776)+math.Log2(10)+math.Log2(5), bits, 1e-9)
+}
+
+func TestLoadWordList(t *testing.T) {
+	words, err := LoadWordList(strings.NewReader("11 apple\n12 banana\n\nbanana\ncherry\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"apple", "banana", "cherry"}, words)
+
+	passphrase, err := GeneratePassphrase(PassphrasePolicy{Words: 3, Separator: ".", WordList: words})
+	assert.NoError(t, err)
+	for _, word := range strings.Split(passphrase, ".") {
+		assert.Contains(t, words, word)
+	}
+
+	_, err = LoadWordList(strings.NewReader("apple\napple\n"))
+	assert.True(t, errors.Is(err, InvalidPolicyError))
+}
@@ -0,0 +1,83 @@
+package totp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Converts the truncated 31 bit value of a token (RFC 4226 section 5.3) into
+// the code shown to the user
+type Encoder interface {
+	Encode(value uint32, length int) (string, error)
+	DefaultLength() int
+}
+
+// Names of the encoders stored with accounts
+const (
+	DecimalEncoding  = "decimal"
+	SteamEncoding    = "steam"
+	AlphabetEncoding = "alphabet"
+)
+
+// The standard encoding; the value modulo 10^length zero padded
+type DecimalEncoder struct{}
+
+func (DecimalEncoder) Encode(value uint32, length int) (string, error) {
+	if length < MinDigits || length > MaxDigits {
+		return "", fmt.Errorf("invalid digit count %d", length)
+	}
+	return fmt.Sprintf("%0*d", length, uint64(value)%digitsModulus[length]), nil
+}
+
+func (DecimalEncoder) DefaultLength() int {
+	return DefaultDigits
+}
+
+// Encodes the value as base len(alphabet) digits least significant first, as
+// Steam Guard does
+type Alphabet string
+
+// The Steam Guard alphabet; its codes are five characters long
+const Steam Alphabet = "23456789BCDFGHJKMNPQRTVWXY"
+
+const steamLength = 5
+
+func (alphabet Alphabet) Encode(value uint32, length int) (string, error) {
+	var symbols = []rune(string(alphabet))
+	if len(symbols) < 2 {
+		return "", fmt.Errorf("alphabet %q is too short", string(alphabet))
+	}
+	if length < 1 {
+		return "", fmt.Errorf("invalid code length %d", length)
+	}
+	var code strings.Builder
+	for i := 0; i < length; i++ {
+		code.WriteRune(symbols[value%uint32(len(symbols))])
+		value /= uint32(len(symbols))
+	}
+	return code.String(), nil
+}
+
+func (alphabet Alphabet) DefaultLength() int {
+	if alphabet == Steam {
+		return steamLength
+	}
+	return DefaultDigits
+}
+
+// The encoder named by an account; the alphabet is only used by the
+// alphabet encoding
+func NewEncoder(encoding string, alphabet string) (Encoder, error) {
+	switch strings.ToLower(encoding) {
+	case DecimalEncoding, "":
+		return DecimalEncoder{}, nil
+	case SteamEncoding:
+		return Steam, nil
+	case AlphabetEncoding:
+		if len([]rune(alphabet)) < 2 {
+			return nil, fmt.Errorf("alphabet %q is too short", alphabet)
+		}
+		return Alphabet(alphabet), nil
+	}
+	return nil, fmt.Errorf("unsupported encoding %q", encoding)
+}
@@ -0,0 +1,69 @@
+package totp
+
+import "fmt"
+
+// Counter based one time password generator (RFC 4226).  The counter must be
+// persisted after every token so a token is never issued twice.
+type HotpGenerator struct {
+	Algorithm Algorithm
+	Secret
+	Digits  int
+	Counter uint64 // counter of the next token
+}
+
+func NewHotpGenerator(secret Secret, counter uint64) HotpGenerator {
+	return HotpGenerator{Algorithm: SHA1, Secret: secret, Digits: DefaultDigits, Counter: counter}
+}
+
+// the digit count treating zero as the default
+func (generator HotpGenerator) digits() int {
+	if generator.Digits == 0 {
+		return DefaultDigits
+	}
+	return generator.Digits
+}
+
+// Calculate the token for a counter value
+func (generator HotpGenerator) Calculate(counter uint64) (uint32, error) {
+	return calculateHotp(generator.Algorithm, generator.Secret, int64(counter), generator.digits())
+}
+
+// Calculate the token for the current counter and advance the counter
+func (generator *HotpGenerator) Next() (uint32, error) {
+	token, err := generator.Calculate(generator.Counter)
+	if err != nil {
+		return 0, err
+	}
+	generator.Counter++
+	return token, nil
+}
+
+// Format a token zero padded to the generator's digit count
+func (generator HotpGenerator) Format(token uint32) string {
+	return fmt.Sprintf("%0*d", generator.digits(), token)
+}
+
+// The otpauth URI of the generator at its current counter
+func (generator HotpGenerator) URI(issuer string, account string) string {
+	return Key{
+		Type:    TypeHOTP,
+		Issuer:  issuer,
+		Account: account,
+		Generator: Generator{
+			Algorithm: generator.Algorithm,
+			Secret:    generator.Secret,
+			Digits:    generator.Digits,
+		},
+		Counter: generator.Counter,
+	}.URI()
+}
+
+// The hotp generator described by the key
+func (key Key) HotpGenerator() HotpGenerator {
+	return HotpGenerator{
+		Algorithm: key.Algorithm,
+		Secret:    key.Secret,
+		Digits:    key.Digits,
+		Counter:   key.Counter,
+	}
+}
@@ -0,0 +1,243 @@
+package totp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"bitbucket.org/jbester/binaryio"
+)
+
+// Challenge formats of OCRA suites
+const (
+	OcraAlphanumeric = 'A'
+	OcraNumeric      = 'N'
+	OcraHex          = 'H'
+)
+
+// Range of OCRA code lengths; a length of zero (no truncation) isn't supported
+const (
+	ocraMinDigits = 4
+	ocraMaxDigits = 10
+)
+
+// size of the challenge in the hashed message
+const ocraChallengeSize = 128
+
+// An OCRA suite (RFC 6287 section 6) e.g. OCRA-1:HOTP-SHA256-8:QN08-T1M
+type OcraSuite struct {
+	Suite           string // the suite's text which is part of every hashed message
+	Algorithm       Algorithm
+	Digits          int
+	Counter         bool          // a counter is an input
+	ChallengeFormat byte          // OcraAlphanumeric, OcraNumeric or OcraHex
+	ChallengeLength int           // challenge length; mutual challenges are two concatenated
+	PinHash         Algorithm     // PIN hash algorithm; empty without a PIN
+	SessionLength   int           // session information bytes; zero without
+	TimeStep        time.Duration // zero without a timestamp
+}
+
+// The inputs of an OCRA code; the suite determines which are used
+type OcraInput struct {
+	Challenge string
+	Counter   uint64
+	PinHash   []byte // see OcraSuite.HashPin
+	Session   []byte
+	Time      time.Time
+}
+
+// Parse an OCRA suite
+func ParseOcraSuite(suite string) (OcraSuite, error) {
+	var parsed = OcraSuite{Suite: suite}
+	var parts = strings.Split(suite, ":")
+	if len(parts) != 3 || parts[0] != "OCRA-1" {
+		return parsed, fmt.Errorf("invalid ocra suite %q", suite)
+	}
+
+	// crypto function e.g. HOTP-SHA1-6
+	var function = strings.Split(parts[1], "-")
+	if len(function) != 3 || function[0] != "HOTP" {
+		return parsed, fmt.Errorf("invalid ocra function %q", parts[1])
+	}
+	parsed.Algorithm = Algorithm(function[1])
+	if _, err := parsed.Algorithm.Hash(); err != nil {
+		return parsed, err
+	}
+	digits, err := strconv.Atoi(function[2])
+	if err != nil || digits < ocraMinDigits || digits > ocraMaxDigits {
+		return parsed, fmt.Errorf("unsupported ocra code length %q", function[2])
+	}
+	parsed.Digits = digits
+
+	// data inputs e.g. C-QN08-PSHA1-S064-T1M
+	for _, input := range strings.Split(parts[2], "-") {
+		if input == "" {
+			return parsed, fmt.Errorf("invalid ocra data input %q", parts[2])
+		}
+		switch input[0] {
+		case 'C':
+			if input != "C" {
+				return parsed, fmt.Errorf("invalid ocra counter %q", input)
+			}
+			parsed.Counter = true
+		case 'Q':
+			if len(input) != 4 || !strings.ContainsRune("ANH", rune(input[1])) {
+				return parsed, fmt.Errorf("invalid ocra challenge %q", input)
+			}
+			parsed.ChallengeFormat = input[1]
+			length, err := strconv.Atoi(input[2:])
+			if err != nil || length < 4 || length > 64 {
+				return parsed, fmt.Errorf("invalid ocra challenge length %q", input)
+			}
+			parsed.ChallengeLength = length
+		case 'P':
+			parsed.PinHash = Algorithm(input[1:])
+			if _, err := parsed.PinHash.Hash(); err != nil || parsed.PinHash == "" {
+				return parsed, fmt.Errorf("invalid ocra pin hash %q", input)
+			}
+		case 'S':
+			length, err := strconv.Atoi(input[1:])
+			if err != nil || len(input) != 4 || length <= 0 {
+				return parsed, fmt.Errorf("invalid ocra session length %q", input)
+			}
+			parsed.SessionLength = length
+		case 'T':
+			if parsed.TimeStep, err = parseOcraTimeStep(input[1:]); err != nil {
+				return parsed, err
+			}
+		default:
+			return parsed, fmt.Errorf("invalid ocra data input %q", input)
+		}
+	}
+	if parsed.ChallengeFormat == 0 {
+		return parsed, fmt.Errorf("ocra suite %q has no challenge", suite)
+	}
+	return parsed, nil
+}
+
+// parse a timestamp step e.g. 30S, 1M or 24H
+func parseOcraTimeStep(step string) (time.Duration, error) {
+	var limits = map[byte]struct {
+		unit time.Duration
+		max  int
+	}{'S': {time.Second, 59}, 'M': {time.Minute, 59}, 'H': {time.Hour, 48}}
+	if step == "" {
+		return 0, fmt.Errorf("invalid ocra time step %q", step)
+	}
+	limit, ok := limits[step[len(step)-1]]
+	count, err := strconv.Atoi(step[:len(step)-1])
+	if !ok || err != nil || count < 1 || count > limit.max {
+		return 0, fmt.Errorf("invalid ocra time step %q", step)
+	}
+	return time.Duration(count) * limit.unit, nil
+}
+
+// Hash a PIN with the suite's PIN hash algorithm
+func (suite OcraSuite) HashPin(pin string) ([]byte, error) {
+	if suite.PinHash == "" {
+		return nil, fmt.Errorf("ocra suite %q has no pin", suite.Suite)
+	}
+	newHash, err := suite.PinHash.Hash()
+	if err != nil {
+		return nil, err
+	}
+	var h = newHash()
+	h.Write([]byte(pin))
+	return h.Sum(nil), nil
+}
+
+// the challenge as the 128 bytes of the hashed message
+func (suite OcraSuite) encodeChallenge(challenge string) ([]byte, error) {
+	if len(challenge) == 0 {
+		return nil, fmt.Errorf("missing challenge")
+	}
+	var encoded []byte
+	switch suite.ChallengeFormat {
+	case OcraAlphanumeric:
+		encoded = []byte(challenge)
+	case OcraNumeric, OcraHex:
+		var hexChallenge = challenge
+		if suite.ChallengeFormat == OcraNumeric {
+			value, ok := new(big.Int).SetString(challenge, 10)
+			if !ok || value.Sign() < 0 {
+				return nil, fmt.Errorf("invalid numeric challenge %q", challenge)
+			}
+			hexChallenge = value.Text(16)
+		}
+		// hex digits are padded on the right so an odd count gains a zero
+		if len(hexChallenge)%2 != 0 {
+			hexChallenge += "0"
+		}
+		var err error
+		if encoded, err = hex.DecodeString(hexChallenge); err != nil {
+			return nil, fmt.Errorf("invalid hex challenge %q", challenge)
+		}
+	}
+	if len(encoded) > ocraChallengeSize {
+		return nil, fmt.Errorf("challenge %q is too long", challenge)
+	}
+	return append(encoded, make([]byte, ocraChallengeSize-len(encoded))...), nil
+}
+
+// The message hashed for the inputs (RFC 6287 section 5.1)
+func (suite OcraSuite) message(input OcraInput) ([]byte, error) {
+	var msg = append([]byte(suite.Suite), 0)
+	if suite.Counter {
+		var writer = binaryio.BigEndianBufferWriter()
+		writer.WriteUint64(input.Counter)
+		msg = append(msg, writer.Bytes()...)
+	}
+	challenge, err := suite.encodeChallenge(input.Challenge)
+	if err != nil {
+		return nil, err
+	}
+	msg = append(msg, challenge...)
+	if suite.PinHash != "" {
+		newHash, _ := suite.PinHash.Hash()
+		if len(input.PinHash) != newHash().Size() {
+			return nil, fmt.Errorf("invalid pin hash")
+		}
+		msg = append(msg, input.PinHash...)
+	}
+	if suite.SessionLength > 0 {
+		if len(input.Session) > suite.SessionLength {
+			return nil, fmt.Errorf("session information longer than %d bytes", suite.SessionLength)
+		}
+		// left padded with zeros
+		msg = append(msg, make([]byte, suite.SessionLength-len(input.Session))...)
+		msg = append(msg, input.Session...)
+	}
+	if suite.TimeStep > 0 {
+		var writer = binaryio.BigEndianBufferWriter()
+		writer.WriteUint64(uint64(input.Time.Unix() / int64(suite.TimeStep/time.Second)))
+		msg = append(msg, writer.Bytes()...)
+	}
+	return msg, nil
+}
+
+// OCRA challenge-response generator
+type OcraGenerator struct {
+	Suite OcraSuite
+	Secret
+}
+
+func NewOcraGenerator(suite OcraSuite, secret Secret) OcraGenerator {
+	return OcraGenerator{Suite: suite, Secret: secret}
+}
+
+// Calculate the response for the inputs
+func (generator OcraGenerator) Calculate(input OcraInput) (string, error) {
+	msg, err := generator.Suite.message(input)
+	if err != nil {
+		return "", err
+	}
+	value, err := truncatedHmac(generator.Suite.Algorithm, generator.Secret, msg)
+	if err != nil {
+		return "", err
+	}
+	var digits = generator.Suite.Digits
+	return fmt.Sprintf("%0*d", digits, uint64(value)%digitsModulus[digits]), nil
+}
@@ -3,6 +3,8 @@ package totp
 import (
 	"crypto/hmac"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/base32"
 	"fmt"
 	"hash"
@@ -12,30 +14,106 @@ import (
 	"bitbucket.org/jbester/binaryio"
 )
 
-func calculateHotp(algorithm func() hash.Hash, secret []byte, intervals_no int64) (uint32, error) {
-	if secret == nil {
-		return 0, fmt.Errorf("invalid secret")
+// HMAC hash algorithm named as in otpauth URIs
+type Algorithm string
+
+const (
+	SHA1   Algorithm = "SHA1"
+	SHA256 Algorithm = "SHA256"
+	SHA512 Algorithm = "SHA512"
+)
+
+// The hash constructor for the algorithm; the empty algorithm is SHA1
+func (algorithm Algorithm) Hash() (func() hash.Hash, error) {
+	switch Algorithm(strings.ToUpper(string(algorithm))) {
+	case SHA1, "":
+		return sha1.New, nil
+	case SHA256:
+		return sha256.New, nil
+	case SHA512:
+		return sha512.New, nil
 	}
+	return nil, fmt.Errorf("unsupported algorithm %q", string(algorithm))
+}
+
+// Range of token lengths
+const (
+	DefaultDigits = 6
+	MinDigits     = 6
+	MaxDigits     = 10
+)
+
+var digitsModulus = []uint64{1, 10, 100, 1000, 10000, 100000, 1000000, 10000000,
+	100000000, 1000000000, 10000000000}
+
+func calculateHotp(algorithm Algorithm, secret []byte, intervals_no int64, digits int) (uint32, error) {
+	if digits < MinDigits || digits > MaxDigits {
+		return 0, fmt.Errorf("invalid digit count %d", digits)
+	}
+	value, err := truncatedHotp(algorithm, secret, intervals_no)
+	return uint32(uint64(value) % digitsModulus[digits]), err
+}
+
+// the 31 bit value of a token before it's reduced to digits
+func truncatedHotp(algorithm Algorithm, secret []byte, intervals_no int64) (uint32, error) {
 	var writer = binaryio.BigEndianBufferWriter()
 	writer.WriteUint64(uint64(intervals_no))
-	msg := writer.Bytes()
-	h := hmac.New(algorithm, secret)
+	return truncatedHmac(algorithm, secret, writer.Bytes())
+}
+
+// the 31 bit dynamically truncated HMAC of a message
+func truncatedHmac(algorithm Algorithm, secret []byte, msg []byte) (uint32, error) {
+	if secret == nil {
+		return 0, fmt.Errorf("invalid secret")
+	}
+	newHash, err := algorithm.Hash()
+	if err != nil {
+		return 0, err
+	}
+	h := hmac.New(newHash, secret)
 	h.Write(msg)
 	digest := h.Sum(nil)
-	o := digest[19] & 15
+	// dynamic truncation (RFC 4226 section 5.3) using the low nibble of the
+	// last byte whatever the digest length
+	o := digest[len(digest)-1] & 15
 	var reader = binaryio.BigEndianBufferReader(digest[o : o+4])
 	token, err := reader.ReadUint32()
 	token &= 0x7fffffff
-	token %= 1000000
 	return token, err
 }
 
 type Secret []byte
 
+// Source of the current time
+type Clock interface {
+	Now() time.Time
+}
+
+// Adapt a function to a Clock
+type ClockFunc func() time.Time
+
+func (clock ClockFunc) Now() time.Time {
+	return clock()
+}
+
+// The system clock
+var SystemClock Clock = ClockFunc(time.Now)
+
+// A clock running offset from another e.g. to correct a drifting system clock
+func OffsetClock(clock Clock, offset time.Duration) Clock {
+	return ClockFunc(func() time.Time {
+		return clock.Now().Add(offset)
+	})
+}
+
 type Generator struct {
-	Algorithm func() hash.Hash
+	Algorithm Algorithm
 	Secret
 	TimeStep int64
+	Digits   int
+	T0       int64   // unix time steps are counted from
+	Clock    Clock   // SystemClock if nil
+	Encoder  Encoder // DecimalEncoder if nil
 }
 
 func Base32Secret(secret string) (Secret, error) {
@@ -48,15 +126,99 @@ func Base32Secret(secret string) (Secret, error) {
 	return key, err
 }
 
+// The secret base32 encoded without padding
+func (secret Secret) Base32() string {
+	return secretEncoding.EncodeToString(secret)
+}
+
 func NewGenerator(secret Secret) Generator {
-	return Generator{TimeStep: 30, Algorithm: sha1.New, Secret: secret}
+	return Generator{TimeStep: 30, Algorithm: SHA1, Secret: secret, Digits: DefaultDigits}
 
 }
 
+// the digit count treating zero as the encoder's default
+func (generator Generator) digits() int {
+	if generator.Digits == 0 {
+		return generator.encoder().DefaultLength()
+	}
+	return generator.Digits
+}
+
+// the encoder treating nil as decimal
+func (generator Generator) encoder() Encoder {
+	if generator.Encoder == nil {
+		return DecimalEncoder{}
+	}
+	return generator.Encoder
+}
+
 func (generator Generator) Calculate(time time.Time) (uint32, error) {
-	return calculateHotp(generator.Algorithm, generator.Secret, time.Unix()/generator.TimeStep)
+	if generator.TimeStep <= 0 {
+		return 0, fmt.Errorf("invalid time step %d", generator.TimeStep)
+	}
+	if time.Unix() < generator.T0 {
+		return 0, fmt.Errorf("time %v is before T0", time)
+	}
+	return generator.CalculateStep(generator.Step(time))
+}
+
+// The number of the time step containing a time; steps before T0 are negative
+func (generator Generator) Step(time time.Time) int64 {
+	var elapsed = time.Unix() - generator.T0
+	if elapsed < 0 {
+		elapsed -= generator.TimeStep - 1
+	}
+	return elapsed / generator.TimeStep
+}
+
+// The time the step containing a time ends and the next token is due
+func (generator Generator) StepEnd(at time.Time) time.Time {
+	return time.Unix((generator.Step(at)+1)*generator.TimeStep+generator.T0, 0)
+}
+
+// Calculate the token of a time step
+func (generator Generator) CalculateStep(step int64) (uint32, error) {
+	return calculateHotp(generator.Algorithm, generator.Secret, step, generator.digits())
+}
+
+// Format a token zero padded to the generator's digit count
+func (generator Generator) Format(token uint32) string {
+	return fmt.Sprintf("%0*d", generator.digits(), token)
+}
+
+// The code for a time encoded by the generator's encoder
+func (generator Generator) Code(time time.Time) (string, error) {
+	if generator.TimeStep <= 0 {
+		return "", fmt.Errorf("invalid time step %d", generator.TimeStep)
+	}
+	if time.Unix() < generator.T0 {
+		return "", fmt.Errorf("time %v is before T0", time)
+	}
+	return generator.CodeStep(generator.Step(time))
+}
+
+// The code of a time step encoded by the generator's encoder
+func (generator Generator) CodeStep(step int64) (string, error) {
+	value, err := truncatedHotp(generator.Algorithm, generator.Secret, step)
+	if err != nil {
+		return "", err
+	}
+	return generator.encoder().Encode(value, generator.digits())
+}
+
+// The current time from the generator's clock
+func (generator Generator) Time() time.Time {
+	if generator.Clock == nil {
+		return SystemClock.Now()
+	}
+	return generator.Clock.Now()
 }
 
 func (generator Generator) Now() (uint32, error) {
-	return generator.Calculate(time.Now())
+	return generator.Calculate(generator.Time())
+}
+
+// The current code from the generator's clock
+func (generator Generator) CodeNow() (string, error) {
+	return generator.Code(generator.Time())
 }
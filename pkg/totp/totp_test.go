@@ -0,0 +1,395 @@
+package totp
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// RFC 6238 appendix B
+var rfc6238Secrets = map[Algorithm]Secret{
+	SHA1:   Secret("12345678901234567890"),
+	SHA256: Secret("12345678901234567890123456789012"),
+	SHA512: Secret("1234567890123456789012345678901234567890123456789012345678901234"),
+}
+
+var rfc6238Vectors = []struct {
+	time      int64
+	algorithm Algorithm
+	token     uint32
+}{
+	{59, SHA1, 94287082},
+	{59, SHA256, 46119246},
+	{59, SHA512, 90693936},
+	{1111111109, SHA1, 7081804},
+	{1111111109, SHA256, 68084774},
+	{1111111109, SHA512, 25091201},
+	{1111111111, SHA1, 14050471},
+	{1111111111, SHA256, 67062674},
+	{1111111111, SHA512, 99943326},
+	{1234567890, SHA1, 89005924},
+	{1234567890, SHA256, 91819424},
+	{1234567890, SHA512, 93441116},
+	{2000000000, SHA1, 69279037},
+	{2000000000, SHA256, 90698825},
+	{2000000000, SHA512, 38618901},
+	{20000000000, SHA1, 65353130},
+	{20000000000, SHA256, 77737706},
+	{20000000000, SHA512, 47863826},
+}
+
+func TestRFC6238Vectors(t *testing.T) {
+	for _, vector := range rfc6238Vectors {
+		var generator = NewGenerator(rfc6238Secrets[vector.algorithm])
+		generator.Algorithm = vector.algorithm
+		token, err := generator.Calculate(time.Unix(vector.time, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, vector.token%1000000, token, "%v at %v", vector.algorithm, vector.time)
+
+		generator.Digits = 8
+		token, err = generator.Calculate(time.Unix(vector.time, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, vector.token, token, "%v at %v", vector.algorithm, vector.time)
+	}
+}
+
+func TestDigitsAndTimeStep(t *testing.T) {
+	var generator = NewGenerator(rfc6238Secrets[SHA1])
+	generator.Digits = 8
+	assert.Equal(t, "07081804", generator.Format(7081804))
+
+	// 60 second steps use the counter of the 30 second step at half the time
+	generator.TimeStep = 60
+	token, err := generator.Calculate(time.Unix(2*1111111109, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(7081804), token)
+
+	// ten digits is the whole truncated value
+	generator.Digits = 10
+	token, err = generator.Calculate(time.Unix(2*1111111109, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(7081804), token%100000000)
+
+	for _, digits := range []int{5, 11} {
+		generator.Digits = digits
+		_, err = generator.Now()
+		assert.Error(t, err)
+	}
+	generator.Digits = 6
+	generator.TimeStep = 0
+	_, err = generator.Now()
+	assert.Error(t, err)
+}
+
+func TestUnsupportedAlgorithm(t *testing.T) {
+	var generator = NewGenerator(rfc6238Secrets[SHA1])
+	generator.Algorithm = "MD5"
+	_, err := generator.Now()
+	assert.Error(t, err)
+}
+
+func TestParseURI(t *testing.T) {
+	key, err := ParseURI("otpauth://totp/ACME%20Co:john.doe@example.com?secret=HXDMVJECJJWSRB3HWIZR4IFUGFTMXBOZ" +
+		"&issuer=ACME%20Co&algorithm=SHA256&digits=8&period=60")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeTOTP, key.Type)
+	assert.Equal(t, "ACME Co", key.Issuer)
+	assert.Equal(t, "john.doe@example.com", key.Account)
+	assert.Equal(t, SHA256, key.Algorithm)
+	assert.Equal(t, 8, key.Digits)
+	assert.Equal(t, int64(60), key.TimeStep)
+
+	// round trip
+	parsed, err := ParseURI(key.URI())
+	assert.NoError(t, err)
+	assert.Equal(t, key, parsed)
+
+	key, err = ParseURI("otpauth://hotp/Example:alice?secret=JBSWY3DPEHPK3PXP&counter=42")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeHOTP, key.Type)
+	assert.Equal(t, uint64(42), key.Counter)
+	assert.Equal(t, SHA1, key.Algorithm)
+	assert.Equal(t, DefaultDigits, key.Digits)
+	parsed, err = ParseURI(key.URI())
+	assert.NoError(t, err)
+	assert.Equal(t, key, parsed)
+
+	for _, uri := range []string{
+		"https://totp/x?secret=JBSWY3DPEHPK3PXP",
+		"otpauth://motp/x?secret=JBSWY3DPEHPK3PXP",
+		"otpauth://totp/x",
+		"otpauth://totp/x?secret=JBSWY3DPEHPK3PXP&digits=4",
+		"otpauth://totp/x?secret=JBSWY3DPEHPK3PXP&algorithm=MD5",
+		"otpauth://hotp/x?secret=JBSWY3DPEHPK3PXP",
+	} {
+		_, err = ParseURI(uri)
+		assert.Error(t, err, uri)
+	}
+}
+
+func TestGeneratorURI(t *testing.T) {
+	var generator = NewGenerator(Secret("12345678901234567890"))
+	assert.Equal(t, "otpauth://totp/Example:alice%20smith?algorithm=SHA1&digits=6&issuer=Example"+
+		"&period=30&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", generator.URI("Example", "alice smith"))
+}
+
+// RFC 4226 appendix D
+var rfc4226Tokens = []uint32{755224, 287082, 359152, 969429, 338314, 254676, 287922, 162583, 399871, 520489}
+
+func TestRFC4226Vectors(t *testing.T) {
+	var generator = NewHotpGenerator(Secret("12345678901234567890"), 0)
+	for i, expected := range rfc4226Tokens {
+		token, err := generator.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, expected, token, "counter %d", i)
+	}
+	assert.Equal(t, uint64(len(rfc4226Tokens)), generator.Counter)
+	assert.Equal(t, "otpauth://hotp/alice?algorithm=SHA1&counter=10&digits=6"+
+		"&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", generator.URI("", "alice"))
+}
+
+func TestVerify(t *testing.T) {
+	var generator = NewGenerator(rfc6238Secrets[SHA1])
+	generator.Digits = 8
+
+	step, err := generator.Verify("94287082", time.Unix(59, 0), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), step)
+
+	// adjacent steps only match within the window
+	step, err = generator.Verify("07081804", time.Unix(1111111109+30, 0), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(37037036), step)
+	step, err = generator.Verify("07081804", time.Unix(1111111109-30, 0), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(37037036), step)
+	_, err = generator.Verify("07081804", time.Unix(1111111109+60, 0), 1)
+	assert.Equal(t, InvalidCodeError, err)
+
+	// leading zeros are significant
+	_, err = generator.Verify("7081804", time.Unix(1111111109, 0), 0)
+	assert.Equal(t, InvalidCodeError, err)
+
+	_, err = generator.Verify("94287082", time.Unix(59, 0), -1)
+	assert.Error(t, err)
+}
+
+func TestHotpVerify(t *testing.T) {
+	var generator = NewHotpGenerator(Secret("12345678901234567890"), 0)
+
+	counter, err := generator.Verify("359152", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), counter)
+	assert.Equal(t, uint64(3), generator.Counter)
+
+	// a used code can't be replayed
+	_, err = generator.Verify("359152", 2)
+	assert.Equal(t, InvalidCodeError, err)
+
+	// beyond the window
+	_, err = generator.Verify("287922", 2)
+	assert.Equal(t, InvalidCodeError, err)
+	assert.Equal(t, uint64(3), generator.Counter)
+}
+
+func TestHotpResync(t *testing.T) {
+	var generator = NewHotpGenerator(Secret("12345678901234567890"), 0)
+
+	// codes must be consecutive
+	assert.Equal(t, InvalidCodeError, generator.Resync("162583", "520489", 10))
+	assert.Equal(t, uint64(0), generator.Counter)
+
+	assert.NoError(t, generator.Resync("162583", "399871", 10))
+	assert.Equal(t, uint64(9), generator.Counter)
+	token, err := generator.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, rfc4226Tokens[9], token)
+}
+
+func TestClock(t *testing.T) {
+	var generator = NewGenerator(rfc6238Secrets[SHA1])
+	generator.Digits = 8
+	generator.Clock = ClockFunc(func() time.Time { return time.Unix(59, 0) })
+	token, err := generator.Now()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(94287082), token)
+
+	// a clock running 30 seconds slow
+	generator.Clock = OffsetClock(ClockFunc(func() time.Time { return time.Unix(1111111079, 0) }), 30*time.Second)
+	token, err = generator.Now()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(7081804), token)
+}
+
+func TestT0(t *testing.T) {
+	var generator = NewGenerator(rfc6238Secrets[SHA1])
+	generator.Digits = 8
+	generator.T0 = 1000
+	token, err := generator.Calculate(time.Unix(1059, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(94287082), token)
+	assert.Equal(t, time.Unix(1060, 0), generator.StepEnd(time.Unix(1059, 0)))
+
+	_, err = generator.Calculate(time.Unix(999, 0))
+	assert.Error(t, err)
+	assert.Equal(t, int64(-1), generator.Step(time.Unix(999, 0)))
+	assert.Equal(t, int64(-1), generator.Step(time.Unix(970, 0)))
+	assert.Equal(t, int64(-2), generator.Step(time.Unix(969, 0)))
+}
+
+func TestEncoders(t *testing.T) {
+	// RFC 4226 appendix D truncated value for counter 0
+	const value = 1284755224
+	code, err := DecimalEncoder{}.Encode(value, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, "755224", code)
+	_, err = DecimalEncoder{}.Encode(value, 5)
+	assert.Error(t, err)
+
+	code, err = Alphabet("0123456789").Encode(value, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, "422557", code)
+	code, err = Steam.Encode(value, Steam.DefaultLength())
+	assert.NoError(t, err)
+	assert.Equal(t, "GG5F5", code)
+	_, err = Alphabet("x").Encode(value, 6)
+	assert.Error(t, err)
+
+	encoder, err := NewEncoder("", "")
+	assert.NoError(t, err)
+	assert.Equal(t, DecimalEncoder{}, encoder)
+	encoder, err = NewEncoder(SteamEncoding, "")
+	assert.NoError(t, err)
+	assert.Equal(t, Steam, encoder)
+	_, err = NewEncoder(AlphabetEncoding, "")
+	assert.Error(t, err)
+	_, err = NewEncoder("base64", "")
+	assert.Error(t, err)
+}
+
+func TestSteamGenerator(t *testing.T) {
+	var generator = NewGenerator(Secret("12345678901234567890"))
+	generator.Encoder = Steam
+	generator.Digits = 0
+	code, err := generator.Code(time.Unix(59, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, "PV9M4", code)
+
+	step, err := generator.Verify("PV9M4", time.Unix(89, 0), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), step)
+
+	var uri = generator.URI("Steam", "alice")
+	assert.Equal(t, "otpauth://totp/Steam:alice?algorithm=SHA1&digits=5&encoder=steam&issuer=Steam"+
+		"&period=30&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", uri)
+	key, err := ParseURI(uri)
+	assert.NoError(t, err)
+	assert.Equal(t, Steam, key.Encoder)
+	assert.Equal(t, 5, key.Digits)
+}
+
+// RFC 6287 appendix C
+var (
+	ocraSeed20 = Secret("12345678901234567890")
+	ocraSeed32 = Secret("12345678901234567890123456789012")
+	ocraSeed64 = Secret("1234567890123456789012345678901234567890123456789012345678901234")
+)
+
+func TestParseOcraSuite(t *testing.T) {
+	suite, err := ParseOcraSuite("OCRA-1:HOTP-SHA512-8:C-QH40-PSHA256-S064-T1M")
+	assert.NoError(t, err)
+	assert.Equal(t, OcraSuite{
+		Suite:           "OCRA-1:HOTP-SHA512-8:C-QH40-PSHA256-S064-T1M",
+		Algorithm:       SHA512,
+		Digits:          8,
+		Counter:         true,
+		ChallengeFormat: OcraHex,
+		ChallengeLength: 40,
+		PinHash:         SHA256,
+		SessionLength:   64,
+		TimeStep:        time.Minute,
+	}, suite)
+
+	for _, invalid := range []string{
+		"OCRA-2:HOTP-SHA1-6:QN08",
+		"OCRA-1:HOTP-MD5-6:QN08",
+		"OCRA-1:HOTP-SHA1-0:QN08",
+		"OCRA-1:HOTP-SHA1-6:C",
+		"OCRA-1:HOTP-SHA1-6:QX08",
+		"OCRA-1:HOTP-SHA1-6:QN80",
+		"OCRA-1:HOTP-SHA1-6:QN08-PMD5",
+		"OCRA-1:HOTP-SHA1-6:QN08-T60M",
+		"OCRA-1:HOTP-SHA1-6:QN08-X",
+	} {
+		_, err = ParseOcraSuite(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func ocraResponse(t *testing.T, suite string, secret Secret, input OcraInput) string {
+	parsed, err := ParseOcraSuite(suite)
+	assert.NoError(t, err, suite)
+	response, err := NewOcraGenerator(parsed, secret).Calculate(input)
+	assert.NoError(t, err, suite)
+	return response
+}
+
+func TestOcraOneWayVectors(t *testing.T) {
+	for i, expected := range []string{"237653", "243178", "653583", "740991", "608993",
+		"388898", "816933", "224598", "750600", "294470"} {
+		var challenge = strings.Repeat(strconv.Itoa(i), 8)
+		assert.Equal(t, expected, ocraResponse(t, "OCRA-1:HOTP-SHA1-6:QN08", ocraSeed20,
+			OcraInput{Challenge: challenge}))
+	}
+
+	suite, _ := ParseOcraSuite("OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1")
+	pinHash, err := suite.HashPin("1234")
+	assert.NoError(t, err)
+	for i, expected := range []string{"65347737", "86775851", "78192410", "71565254", "10104329",
+		"65983500", "70069104", "91771096", "75011558", "08522129"} {
+		assert.Equal(t, expected, ocraResponse(t, suite.Suite, ocraSeed32,
+			OcraInput{Challenge: "12345678", Counter: uint64(i), PinHash: pinHash}))
+	}
+
+	for i, expected := range []string{"83238735", "01501458", "17957585", "86776967", "86807031"} {
+		var challenge = strings.Repeat(strconv.Itoa(i), 8)
+		assert.Equal(t, expected, ocraResponse(t, "OCRA-1:HOTP-SHA256-8:QN08-PSHA1", ocraSeed32,
+			OcraInput{Challenge: challenge, PinHash: pinHash}))
+	}
+
+	for i, expected := range []string{"07016083", "63947962", "70123924", "25341727", "33203315",
+		"34205738", "44343969", "51946085", "20403879", "31409299"} {
+		var challenge = strings.Repeat(strconv.Itoa(i), 8)
+		assert.Equal(t, expected, ocraResponse(t, "OCRA-1:HOTP-SHA512-8:C-QN08", ocraSeed64,
+			OcraInput{Challenge: challenge, Counter: uint64(i)}))
+	}
+
+	var timestamp = time.Unix(0x132d0b6*60, 0)
+	for i, expected := range []string{"95209754", "55907591", "22048402", "24218844", "36209546"} {
+		var challenge = strings.Repeat(strconv.Itoa(i), 8)
+		assert.Equal(t, expected, ocraResponse(t, "OCRA-1:HOTP-SHA512-8:QN08-T1M", ocraSeed64,
+			OcraInput{Challenge: challenge, Time: timestamp}))
+	}
+}
+
+func TestOcraMutualAndSignatureVectors(t *testing.T) {
+	for _, vector := range []struct {
+		suite     string
+		secret    Secret
+		challenge string
+		expected  string
+	}{
+		{"OCRA-1:HOTP-SHA256-8:QA08", ocraSeed32, "CLI22220SRV11110", "28247970"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", ocraSeed32, "CLI22221SRV11111", "01984843"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", ocraSeed32, "SRV11110CLI22220", "15510767"},
+		{"OCRA-1:HOTP-SHA512-8:QA08", ocraSeed64, "CLI22220SRV11110", "79496648"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", ocraSeed32, "SIG10000", "53095496"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", ocraSeed32, "SIG11000", "04110475"},
+	} {
+		assert.Equal(t, vector.expected, ocraResponse(t, vector.suite, vector.secret,
+			OcraInput{Challenge: vector.challenge}), vector.challenge)
+	}
+}
@@ -0,0 +1,141 @@
+package totp
+
+import (
+	"encoding/base32"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Key types of otpauth URIs
+const (
+	TypeTOTP = "totp"
+	TypeHOTP = "hotp"
+)
+
+const uriScheme = "otpauth"
+
+// An account as described by an otpauth:// URI
+type Key struct {
+	Type    string
+	Issuer  string
+	Account string
+	Generator
+	Counter uint64 // initial counter of hotp keys
+}
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Parse an otpauth://totp/ or otpauth://hotp/ URI
+func ParseURI(uri string) (Key, error) {
+	var key Key
+	parsed, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return key, err
+	}
+	if parsed.Scheme != uriScheme {
+		return key, fmt.Errorf("not an otpauth URI")
+	}
+	key.Type = strings.ToLower(parsed.Host)
+	if key.Type != TypeTOTP && key.Type != TypeHOTP {
+		return key, fmt.Errorf("unsupported key type %q", parsed.Host)
+	}
+
+	// the label is "account" or "issuer:account"
+	var label = strings.TrimPrefix(parsed.Path, "/")
+	if i := strings.Index(label, ":"); i >= 0 {
+		key.Issuer = strings.TrimSpace(label[:i])
+		label = label[i+1:]
+	}
+	key.Account = strings.TrimSpace(label)
+
+	var query = parsed.Query()
+	if issuer := query.Get("issuer"); issuer != "" {
+		key.Issuer = issuer
+	}
+
+	var secret = strings.ToUpper(strings.TrimRight(query.Get("secret"), "="))
+	if secret == "" {
+		return key, fmt.Errorf("missing secret")
+	}
+	if key.Secret, err = Base32Secret(secret); err != nil {
+		return key, err
+	}
+
+	key.Generator = NewGenerator(key.Secret)
+	if algorithm := query.Get("algorithm"); algorithm != "" {
+		key.Algorithm = Algorithm(strings.ToUpper(algorithm))
+		if _, err = key.Algorithm.Hash(); err != nil {
+			return key, err
+		}
+	}
+	// the encoder parameter as written by KeePassXC for Steam Guard keys
+	if encoder := query.Get("encoder"); encoder != "" {
+		if !strings.EqualFold(encoder, SteamEncoding) {
+			return key, fmt.Errorf("unsupported encoder %q", encoder)
+		}
+		key.Encoder = Steam
+		key.Digits = steamLength
+	}
+	if digits := query.Get("digits"); digits != "" {
+		if key.Digits, err = strconv.Atoi(digits); err != nil {
+			return key, fmt.Errorf("invalid digits %q", digits)
+		}
+		if key.Encoder == nil && (key.Digits < MinDigits || key.Digits > MaxDigits) {
+			return key, fmt.Errorf("invalid digit count %d", key.Digits)
+		}
+	}
+	if period := query.Get("period"); period != "" {
+		if key.TimeStep, err = strconv.ParseInt(period, 10, 64); err != nil || key.TimeStep <= 0 {
+			return key, fmt.Errorf("invalid period %q", period)
+		}
+	}
+	if key.Type == TypeHOTP {
+		var counter = query.Get("counter")
+		if counter == "" {
+			return key, fmt.Errorf("missing counter")
+		}
+		if key.Counter, err = strconv.ParseUint(counter, 10, 64); err != nil {
+			return key, fmt.Errorf("invalid counter %q", counter)
+		}
+	}
+	return key, nil
+}
+
+// The otpauth URI of the key
+func (key Key) URI() string {
+	var keyType = key.Type
+	if keyType == "" {
+		keyType = TypeTOTP
+	}
+
+	var label = key.Account
+	var query = url.Values{}
+	query.Set("secret", key.Secret.Base32())
+	if key.Issuer != "" {
+		label = key.Issuer + ":" + key.Account
+		query.Set("issuer", key.Issuer)
+	}
+	if key.Algorithm != "" {
+		query.Set("algorithm", string(key.Algorithm))
+	}
+	query.Set("digits", strconv.Itoa(key.digits()))
+	if key.Encoder == Steam {
+		query.Set("encoder", SteamEncoding)
+	}
+	if keyType == TypeHOTP {
+		query.Set("counter", strconv.FormatUint(key.Counter, 10))
+	} else if key.TimeStep != 0 {
+		query.Set("period", strconv.FormatInt(key.TimeStep, 10))
+	}
+
+	var uri = url.URL{Scheme: uriScheme, Host: keyType, Path: "/" + label}
+	// spaces as %20 rather than + since authenticator apps disagree on +
+	return uri.String() + "?" + strings.Replace(query.Encode(), "+", "%20", -1)
+}
+
+// The otpauth URI of a totp generator
+func (generator Generator) URI(issuer string, account string) string {
+	return Key{Type: TypeTOTP, Issuer: issuer, Account: account, Generator: generator}.URI()
+}
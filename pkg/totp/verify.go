@@ -0,0 +1,88 @@
+package totp
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var InvalidCodeError = errors.New("invalid code")
+
+// compare a submitted code against a formatted token in constant time
+func codeMatches(code string, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(code), []byte(expected)) == 1
+}
+
+// Verify a code against the time steps within window steps either side of
+// at; closer steps are checked first.  The matched step is returned so the
+// caller can record it and reject any later code for that step or an earlier
+// one; otherwise a code stays valid for its whole window.
+func (generator Generator) Verify(code string, at time.Time, window int) (int64, error) {
+	if generator.TimeStep <= 0 {
+		return 0, fmt.Errorf("invalid time step %d", generator.TimeStep)
+	}
+	if window < 0 {
+		return 0, fmt.Errorf("invalid window %d", window)
+	}
+	var current = generator.Step(at)
+	var steps = []int64{current}
+	for offset := int64(1); offset <= int64(window); offset++ {
+		steps = append(steps, current-offset, current+offset)
+	}
+	for _, step := range steps {
+		if step < 0 {
+			continue
+		}
+		expected, err := generator.CodeStep(step)
+		if err != nil {
+			return 0, err
+		}
+		if codeMatches(code, expected) {
+			return step, nil
+		}
+	}
+	return 0, InvalidCodeError
+}
+
+// Verify a code against the counters from the generator's counter up to
+// window counters ahead.  On a match the counter moves past the matched
+// counter, which is returned, so the code can't be used again.
+func (generator *HotpGenerator) Verify(code string, window uint64) (uint64, error) {
+	for counter := generator.Counter; counter <= generator.Counter+window; counter++ {
+		token, err := generator.Calculate(counter)
+		if err != nil {
+			return 0, err
+		}
+		if codeMatches(code, generator.Format(token)) {
+			generator.Counter = counter + 1
+			return counter, nil
+		}
+	}
+	return 0, InvalidCodeError
+}
+
+// Resynchronise with a token whose counter has run ahead of ours by looking
+// up to window counters ahead for two consecutive codes (RFC 4226 section
+// 7.4).  Two codes are required since a single code in a large window is
+// much easier to guess.
+func (generator *HotpGenerator) Resync(first string, second string, window uint64) error {
+	for counter := generator.Counter; counter <= generator.Counter+window; counter++ {
+		token, err := generator.Calculate(counter)
+		if err != nil {
+			return err
+		}
+		if !codeMatches(first, generator.Format(token)) {
+			continue
+		}
+		next, err := generator.Calculate(counter + 1)
+		if err != nil {
+			return err
+		}
+		if codeMatches(second, generator.Format(next)) {
+			generator.Counter = counter + 2
+			return nil
+		}
+	}
+	return InvalidCodeError
+}